@@ -0,0 +1,133 @@
+package edit
+
+import "sort"
+
+// Annotation is text displayed in a line that is not part of the buffer's
+// contents, such as an inlay type hint or an inline diagnostic. Annotations
+// take up space on the display, so they affect wrapping and display
+// coordinates, but they are not returned by Get, matched by searches, or
+// recorded in the undo history. Tag is usually a display tag; see
+// DisplayTag.
+type Annotation struct {
+	Index Index
+	Text  string
+	Tag   int
+
+	// EndOfLine is true if the annotation is displayed after the end of the
+	// line of Index, rather than before the character at Index.
+	EndOfLine bool
+}
+
+// AddAnnotations adds annotations to the buffer's display and returns their
+// IDs. Like marks, the indexes of annotations are automatically updated when
+// the buffer contents are modified. Annotations at the same index are
+// displayed in the order they were added. An index displayed after an
+// annotation has the display coordinates of the beginning of the annotation.
+func (b *Buffer) AddAnnotations(annotations ...Annotation) []int {
+	<-b.unlock
+	ids := make([]int, len(annotations))
+	lines := make(map[int]bool)
+	for i, a := range annotations {
+		a.Index = b.clip(a.Index)
+		b.nextAnnotation++
+		b.annotations[b.nextAnnotation] = a
+		ids[i] = b.nextAnnotation
+		lines[a.Index.Line] = true
+	}
+	b.annotationLines = nil
+	for line := range lines {
+		b.relayout(line)
+	}
+	b.unlock <- 1
+	return ids
+}
+
+// RemoveAnnotations removes the annotations with the given IDs, if they
+// exist.
+func (b *Buffer) RemoveAnnotations(id ...int) {
+	<-b.unlock
+	lines := make(map[int]bool)
+	for _, id := range id {
+		if a, ok := b.annotations[id]; ok {
+			delete(b.annotations, id)
+			lines[a.Index.Line] = true
+		}
+	}
+	b.annotationLines = nil
+	for line := range lines {
+		b.relayout(line)
+	}
+	b.unlock <- 1
+}
+
+// AnnotationIndex returns the current index of the annotation with ID id, or
+// a zero-value index if no annotation with ID id exists.
+func (b *Buffer) AnnotationIndex(id int) Index {
+	<-b.unlock
+	index := b.annotations[id].Index
+	b.unlock <- 1
+	return index
+}
+
+// annotationsOn returns the annotations on line, with inline annotations in
+// order of index followed by end-of-line annotations, each in the order they
+// were added.
+func (b *Buffer) annotationsOn(line int) []Annotation {
+	if len(b.annotations) == 0 {
+		return nil
+	}
+	if b.annotationLines == nil {
+		b.annotationLines = make(map[int][]int)
+		for id, a := range b.annotations {
+			b.annotationLines[a.Index.Line] =
+				append(b.annotationLines[a.Index.Line], id)
+		}
+	}
+	ids := b.annotationLines[line]
+	sort.Slice(ids, func(i, j int) bool {
+		p, q := b.annotations[ids[i]], b.annotations[ids[j]]
+		if p.EndOfLine != q.EndOfLine {
+			return q.EndOfLine
+		} else if !p.EndOfLine && p.Index.Char != q.Index.Char {
+			return p.Index.Char < q.Index.Char
+		}
+		return ids[i] < ids[j]
+	})
+	annotations := make([]Annotation, len(ids))
+	for i, id := range ids {
+		annotations[i] = b.annotations[id]
+	}
+	return annotations
+}
+
+// moveAnnotations updates the indexes of annotations after an edit using
+// move, which returns the new position of an index.
+func (b *Buffer) moveAnnotations(move func(Index) Index) {
+	if len(b.annotations) == 0 {
+		return
+	}
+	for id, a := range b.annotations {
+		a.Index = move(a.Index)
+		b.annotations[id] = a
+	}
+	b.annotationLines = nil
+}
+
+// relayout lays out line again in each view, keeping its highlighting.
+func (b *Buffer) relayout(line int) {
+	for _, v := range b.views {
+		display := v.dLines.Get(line).Value.(lineDisplay)
+		v.set(line, v.relayout(line, display))
+	}
+}
+
+// relayout returns display, the display of line i, laid out again.
+func (v *View) relayout(i int, display lineDisplay) lineDisplay {
+	l := v.layout(i, v.b.lines.Line(i))
+	fragments := display.fragments
+	if fragments == nil {
+		fragments = l.plain()
+	}
+	display.rows = l.rows(fragments)
+	return display
+}
@@ -0,0 +1,112 @@
+package edit
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestBufferAnnotations(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(6, 4)
+	b.Insert(b.End(), "let x = 1\nfoo")
+
+	hint, diagnostic := DisplayTag("hint"), DisplayTag("diagnostic")
+	ids := b.AddAnnotations(
+		Annotation{Index{1, 5}, ": int", hint, false},
+		Annotation{Index{2, 0}, "!", diagnostic, true},
+	)
+	want := [][]Fragment{{{"let x", noneTag}, {":", hint}},
+		{{" int", hint}, {" =", noneTag}}, {{" 1", noneTag}},
+		{{"foo", noneTag}, {"!", diagnostic}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// annotations take up display coordinates, but not indexes
+	for _, c := range []struct {
+		index    Index
+		col, row int
+	}{
+		{Index{1, 5}, 5, 0},
+		{Index{1, 6}, 5, 1},
+		{Index{2, 3}, 3, 3},
+	} {
+		if col, row := b.CoordsFromIndex(c.index); col != c.col || row != c.row {
+			t.Errorf("CoordsFromIndex(%v) == %v, %v; want %v, %v",
+				c.index, col, row, c.col, c.row)
+		}
+		if index := b.IndexFromCoords(c.col, c.row); index != c.index {
+			t.Errorf("IndexFromCoords(%v, %v) == %v; want %v",
+				c.col, c.row, index, c.index)
+		}
+	}
+	if want, got := (Index{1, 5}), b.IndexFromCoords(2, 1); want != got {
+		t.Errorf("IndexFromCoords(2, 1) == %v; want %v", got, want)
+	}
+
+	// annotations aren't text of the buffer
+	if want, got := "let x = 1\nfoo", b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %q; want %q", got, want)
+	}
+	if match := b.Find(regexp.MustCompile(`int`), Index{1, 0},
+		FindOptions{}); match != nil {
+		t.Errorf("Find() == %v; want nil", match)
+	}
+
+	// annotations follow edits, including undo
+	b.Separate()
+	b.Insert(Index{1, 0}, "  ")
+	if want, got := (Index{1, 7}), b.AnnotationIndex(ids[0]); want != got {
+		t.Errorf("AnnotationIndex() == %v; want %v", got, want)
+	}
+	b.Undo()
+	if want, got := (Index{1, 5}), b.AnnotationIndex(ids[0]); want != got {
+		t.Errorf("AnnotationIndex() == %v; want %v", got, want)
+	}
+	b.Delete(Index{1, 3}, Index{2, 1})
+	if want, got := (Index{1, 3}), b.AnnotationIndex(ids[0]); want != got {
+		t.Errorf("AnnotationIndex() == %v; want %v", got, want)
+	}
+	want = [][]Fragment{{{"let", noneTag}, {": i", hint}},
+		{{"nt", hint}, {"oo", noneTag}, {"!", diagnostic}}, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	b.RemoveAnnotations(ids...)
+	want = [][]Fragment{{{"letoo", noneTag}}, nil, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	if want, got := (Index{}), b.AnnotationIndex(ids[0]); want != got {
+		t.Errorf("AnnotationIndex() == %v; want %v", got, want)
+	}
+}
+
+func TestBufferAnnotationsHighlighted(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(8, 3)
+	rule, _ := NewRule(`[0-9]+`, 1)
+	b.SetSyntax([]Rule{rule})
+	b.Insert(b.End(), "f(1, 23)")
+
+	hint, selection := DisplayTag("hint"), DisplayTag("selection")
+	b.AddAnnotations(Annotation{Index{1, 5}, "y=", hint, false})
+	b.AddOverlays(Overlay{Index{1, 3}, Index{1, 6}, selection, 0})
+
+	// syntax tags are kept and overlays don't apply to annotations
+	want := [][]Fragment{{{"f(", noneTag}, {"1", 1}, {", ", selection},
+		{"y=", hint}, {"2", selection}}, {{"3", 1}, {")", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// ... even after the display is resized
+	b.SetSize(20, 3)
+	want = [][]Fragment{{{"f(", noneTag}, {"1", 1}, {", ", selection},
+		{"y=", hint}, {"2", selection}, {"3", 1}, {")", noneTag}}, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+}
@@ -2,80 +2,121 @@
 package edit
 
 import (
+	"bufio"
+	"bytes"
 	"container/list"
 	"crypto/md5"
+	"io"
 	"strings"
+	"unicode/utf8"
 )
 
-func getElem(l *list.List, n int) *list.Element {
-	var elem *list.Element
-	if n > l.Len()/2 {
-		elem = l.Back()
-		for i := l.Len(); i > n; i-- {
-			elem = elem.Prev()
-		}
-	} else {
-		elem = l.Front()
-		for n = n; n > 1; n-- {
-			elem = elem.Next()
-		}
-	}
-	return elem
-}
-
-type fragList struct {
-	*list.List
-	cont bool
-}
+// fragList is a display line.
+type fragList []Fragment
 
-type lineInfo struct {
-	text []rune
-	disp *list.Element
+// lineDisplay is the display of a line of text.
+type lineDisplay struct {
+	rows       []fragList // display lines, or nil if not laid out yet
+	fragments  []Fragment // highlighted text, or nil if not highlighted
+	syntax     int        // version of syntax used to tag rows, or 0
+	begin, end int        // syntax states at beginning and end of line
 }
 
 type bufferOp struct {
-	insert     bool // if not insert, then delete
-	start, end Index
-	text       []rune
+	insert        bool // if not insert, then delete
+	start, end    Index
+	text          []rune
+	before, after int // buffer versions before and after the operation
 }
 
 type separator struct{} // for use in undo and redo stacks
 
 // Buffer is a thread-safe text-editing buffer.
 type Buffer struct {
-	lines      *list.List // list of lineInfos
-	dLines     *list.List // display lines; list of fragLists
-	unlock     chan int   // used as mutex
-	strings    []string   // for misc. use *only* when locked
-	checksum   [md5.Size]byte
-	syntax     syntax
-	cols, rows int // display size
-	tabWidth   int
-	scroll     int
-	marks      map[int]Index
-	undo, redo *list.List // undo and redo stacks
-}
-
-// NewBuffer initializes and returns a new empty Buffer.
+	lines           lineStore
+	view            *View    // the buffer's own display
+	views           []*View  // displays of the buffer, including view
+	unlock          chan int // used as mutex
+	strings         []string // for misc. use *only* when locked
+	syntax          syntax
+	marks           map[int]Index
+	signs           map[int]placedSign
+	folds           map[int]fold
+	foldSpans       []fold // sorted folds, each ending at the latest end so far; nil if stale
+	overlays        map[int]Overlay
+	annotations     map[int]Annotation
+	annotationLines map[int][]int // annotation IDs by line, or nil
+	undo, redo      *list.List    // undo and redo stacks
+	lineEnding      LineEnding
+	mixed           bool // true if loaded contents had mixed line endings
+	encoding        Encoding
+	version         int // identifies the current contents
+	saved           int // version at last ResetModified
+	versions        int // last version assigned
+
+	syntaxVersion  int    // incremented by SetSyntax
+	onHighlight    func() // background highlighting callback
+	highlighting   bool   // true if background highlighting is running
+	listeners      []listener
+	nextListener   int // last listener ID assigned
+	nextSign       int // last sign ID assigned
+	nextFold       int // last fold ID assigned
+	nextOverlay    int // last overlay ID assigned
+	nextAnnotation int // last annotation ID assigned
+	subscriptions  []*subscription
+}
+
+// Storage denotes a storage engine for the text of a Buffer.
+type Storage int
+
+// Storage engines.
+const (
+	// LineStorage stores each line as a separate slice of runes. Access to
+	// text is fast, but loading text requires decoding all of it.
+	LineStorage Storage = iota
+
+	// PieceTableStorage stores text as a piece table over the bytes of
+	// loaded UTF-8 text and an append-only buffer of inserted text. Loading
+	// text is fast and memory use stays proportional to the size of the
+	// loaded text plus the edits, but text must be decoded on access.
+	PieceTableStorage
+)
+
+// Options holds configuration for a new Buffer.
+type Options struct {
+	Storage Storage // storage engine for the buffer's text
+}
+
+// NewBuffer initializes and returns a new empty Buffer using the default
+// options.
 func NewBuffer() *Buffer {
+	return NewBufferWithOptions(Options{})
+}
+
+// NewBufferWithOptions initializes and returns a new empty Buffer configured
+// by opts.
+func NewBufferWithOptions(opts Options) *Buffer {
+	var lines lineStore = newTreeStore()
+	if opts.Storage == PieceTableStorage {
+		lines = newPieceStore()
+	}
 	b := Buffer{
-		lines:    list.New(),
-		dLines:   list.New(),
-		unlock:   make(chan int, 1),
-		strings:  make([]string, 0),
-		checksum: md5.Sum([]byte{}),
-		syntax:   []Rule{},
-		cols:     80,
-		rows:     25,
-		tabWidth: 8,
-		scroll:   0,
-		marks:    make(map[int]Index),
-		undo:     list.New(),
-		redo:     list.New(),
-	}
-	dLine := fragList{list.New(), false}
-	dLine.PushBack(Fragment{})
-	b.lines.PushBack(lineInfo{[]rune(""), b.dLines.PushBack(dLine)})
+		lines:       lines,
+		unlock:      make(chan int, 1),
+		strings:     make([]string, 0),
+		syntax:      []Rule{},
+		marks:       make(map[int]Index),
+		signs:       make(map[int]placedSign),
+		folds:       make(map[int]fold),
+		overlays:    make(map[int]Overlay),
+		annotations: make(map[int]Annotation),
+		undo:        list.New(),
+		redo:        list.New(),
+		lineEnding:  LF,
+		encoding:    UTF8,
+	}
+	b.syntaxVersion = 1 // so that new lines are not considered highlighted
+	b.view = b.newView()
 	b.unlock <- 1
 	return &b
 }
@@ -89,7 +130,7 @@ func (b *Buffer) clip(index Index) Index {
 	if index.Char < 0 {
 		index.Char = 0
 	} else {
-		lineLen := len(getElem(b.lines, index.Line).Value.(lineInfo).text)
+		lineLen := b.lines.LineLen(index.Line)
 		if index.Char > lineLen {
 			index.Char = lineLen
 		}
@@ -97,175 +138,93 @@ func (b *Buffer) clip(index Index) Index {
 	return index
 }
 
-func (b *Buffer) insertFragment(frag Fragment, dLine fragList, col int,
-	prev *list.Element) (fragList, int, *list.Element) {
-	text := []rune(frag.Text)
-	for {
-		if len(text)+col <= b.cols {
-			if dLine.Len() > 0 &&
-				frag.Tag == dLine.Back().Value.(Fragment).Tag {
-				val := dLine.Back().Value.(Fragment)
-				val.Text += string(text)
-				dLine.Back().Value = val
-			} else {
-				dLine.PushBack(Fragment{string(text), frag.Tag})
-			}
-			col += len(text)
-			text = text[:0]
-		} else {
-			if col < b.cols {
-				if dLine.Len() > 0 &&
-					frag.Tag == dLine.Back().Value.(Fragment).Tag {
-					val := dLine.Back().Value.(Fragment)
-					val.Text += string(text[:b.cols-col])
-					dLine.Back().Value = val
-				} else {
-					dLine.PushBack(Fragment{string(text[:b.cols-col]),
-						frag.Tag})
-				}
-			}
-			prev = b.dLines.InsertAfter(dLine, prev)
-			dLine = fragList{list.New(), true}
-			text = text[b.cols-col:]
-			col = 0
-		}
-		if len(text) == 0 {
-			break
-		}
-	}
-	return dLine, col, prev
-}
-
+// redisplay rewraps the lines from begin to end in each view.
 func (b *Buffer) redisplay(begin, end int) {
-	beginElem, endElem := getElem(b.lines, begin), getElem(b.lines, end)
-	for elem := beginElem; elem != nil; elem = elem.Next() {
-		// Remove existing display lines, but keep first as an anchor
-		first := elem.Value.(lineInfo).disp
-		disp := first.Next()
-		for disp != nil && disp.Value.(fragList).cont {
-			next := disp.Next()
-			b.dLines.Remove(disp)
-			disp = next
-		}
-		// Insert new display lines
-		prev := first
-		dLine, col := fragList{list.New(), false}, 0
-		fragments := b.syntax.split(string(expand(elem.Value.(lineInfo).text,
-			b.tabWidth)))
-		for frag := range fragments {
-			dLine, col, prev = b.insertFragment(frag, dLine, col, prev)
-		}
-		b.dLines.InsertAfter(dLine, prev)
-		elem.Value = lineInfo{elem.Value.(lineInfo).text, first.Next()}
-		// Remove leftover display line
-		b.dLines.Remove(first)
-		// Break if end line has been processed
-		if elem == endElem {
-			break
-		}
+	for _, v := range b.views {
+		v.redisplay(begin, end)
 	}
 }
 
-// resize is like redisplay, except it doesn't re-highlight the text.
-func (b *Buffer) resize() {
-	for elem := b.lines.Front(); elem != nil; elem = elem.Next() {
-		// consolidate display lines into a single fragList
-		first := elem.Value.(lineInfo).disp
-		fragments := first.Value.(fragList)
-		disp := first.Next()
-		for disp != nil && disp.Value.(fragList).cont {
-			next := disp.Next()
-			fragments.PushBackList(disp.Value.(fragList).List)
-			b.dLines.Remove(disp)
-			disp = next
-		}
-		// ... then un-consolidate the fragList back into display lines
-		prev := first
-		dLine, col := fragList{list.New(), false}, 0
-		for e := fragments.Front(); e != nil; e = e.Next() {
-			frag := e.Value.(Fragment)
-			dLine, col, prev = b.insertFragment(frag, dLine, col, prev)
+// Checksum returns the MD5 checksum of the buffer's contents, with lines
+// separated by "\n". This operation is expensive, since it must hash the
+// entire buffer contents, but can be used to compare the contents with
+// external data.
+func (b *Buffer) Checksum() [md5.Size]byte {
+	<-b.unlock
+	var sum [md5.Size]byte
+	hash := md5.New()
+	b.lines.Walk(1, func(i int, text []rune) bool {
+		if i > 1 {
+			io.WriteString(hash, "\n")
 		}
-		b.dLines.InsertAfter(dLine, prev)
-		elem.Value = lineInfo{elem.Value.(lineInfo).text, first.Next()}
-		// remove leftover display line
-		b.dLines.Remove(first)
-	}
+		io.WriteString(hash, string(text))
+		return true
+	})
+	copy(sum[:], hash.Sum(nil))
+	b.unlock <- 1
+	return sum
 }
 
 // CoordsFromIndex returns the display coordinates of index. Coordinates may be
 // out of bounds of the buffer's current display.
 func (b *Buffer) CoordsFromIndex(index Index) (col, row int) {
-	<-b.unlock
-	row -= b.scroll
-	index = b.clip(index)
-	line := getElem(b.lines, index.Line).Value.(lineInfo)
-	for e := b.dLines.Front(); e != line.disp; e = e.Next() {
-		row++
-	}
-	col = columns(line.text[:index.Char], b.tabWidth)
-	row += col / b.cols
-	col %= b.cols
-	b.unlock <- 1
-	return
+	return b.view.CoordsFromIndex(index)
 }
 
 // delete_ performs a deletion without modifying the undo stack.
 func (b *Buffer) delete(begin, end Index) {
 	// perform deletion
-	elem := getElem(b.lines, begin.Line)
-	if n := end.Line - begin.Line; n == 0 {
-		text := elem.Value.(lineInfo).text
-		elem.Value = lineInfo{append(text[:begin.Char], text[end.Char:]...),
-			elem.Value.(lineInfo).disp}
-	} else {
-		firstLine := elem.Value.(lineInfo).text
-		for i := 0; i < n; i++ {
-			elem = elem.Next()
-			e := b.lines.Remove(elem.Prev()).(lineInfo).disp
-			for {
-				next := e.Next()
-				b.dLines.Remove(e)
-				e = next
-				if e == nil || !e.Value.(fragList).cont {
-					break
-				}
-			}
+	b.lines.Delete(begin, end)
+	if end.Line > begin.Line {
+		for _, v := range b.views {
+			v.dLines.Remove(begin.Line+1, end.Line)
+			v.moveLayout(begin.Line, begin.Line-end.Line)
 		}
-		elem.Value = lineInfo{append(firstLine[:begin.Char],
-			elem.Value.(lineInfo).text[end.Char:]...),
-			elem.Value.(lineInfo).disp}
 	}
+	move := func(v Index) Index { return afterDelete(v, begin, end) }
+	b.moveFolds(begin.Line, begin.Line-end.Line)
+	b.moveAnnotations(move)
 	b.redisplay(begin.Line, begin.Line)
+	b.moveSigns(begin.Line, begin.Line-end.Line)
 
 	// update marks
 	for k, v := range b.marks {
-		if v.Line > begin.Line ||
-			(v.Line == begin.Line && v.Char >= begin.Char) {
-			if v.Line <= end.Line {
-				if v.Line < end.Line || v.Char <= end.Char {
-					v = begin
-				} else {
-					v.Line = begin.Line
-					v.Char += begin.Char - end.Char
-				}
+		b.marks[k] = move(v)
+	}
+	b.moveOverlays(move)
+}
+
+// afterDelete returns the position of v after the text between begin and
+// end is deleted.
+func afterDelete(v, begin, end Index) Index {
+	if v.Line > begin.Line ||
+		(v.Line == begin.Line && v.Char >= begin.Char) {
+		if v.Line <= end.Line {
+			if v.Line < end.Line || v.Char <= end.Char {
+				v = begin
 			} else {
-				v.Line -= end.Line - begin.Line
+				v.Line = begin.Line
+				v.Char += begin.Char - end.Char
 			}
+		} else {
+			v.Line -= end.Line - begin.Line
 		}
-		b.marks[k] = v
 	}
+	return v
 }
 
-// Delete removes the text in the buffer between begin and end.
+// Delete removes the text in the buffer between begin and end. Indexes inside
+// a grapheme cluster are moved outward to its boundaries, so that deleting
+// from ShiftIndex(index, -1) to index removes a whole user-perceived
+// character.
 func (b *Buffer) Delete(begin, end Index) {
 	<-b.unlock
-	if end.Less(begin) || end == begin {
+	if begin, end = b.snap(begin), b.snapEnd(end); !begin.Less(end) {
 		b.unlock <- 1
 		return
 	}
-	begin, end = b.clip(begin), b.clip(end)
 	runes := []rune(b.get(begin, end))
+	b.versions++
 
 	// insert undo operation (merge with previous deletion if possible)
 	merged := false
@@ -275,54 +234,59 @@ func (b *Buffer) Delete(begin, end Index) {
 				b.undo.Remove(b.undo.Back())
 				op.start = begin
 				op.text = append(runes, op.text...)
+				op.after = b.versions
 				b.undo.PushBack(op)
 				merged = true
 			} else if op.end == begin {
 				b.undo.Remove(b.undo.Back())
 				op.end = end
 				op.text = append(op.text, runes...)
+				op.after = b.versions
 				b.undo.PushBack(op)
 				merged = true
 			}
 		}
 	}
 	if !merged {
-		b.undo.PushBack(bufferOp{false, begin, end, runes})
+		b.undo.PushBack(bufferOp{false, begin, end, runes, b.version,
+			b.versions})
 	}
 	b.redo.Init()
+	b.version = b.versions
 
 	b.delete(begin, end)
+	b.notify(DeleteChange, begin, end, runes, EditOrigin)
 	b.unlock <- 1
 }
 
 // DisplayLines returns a slice of Lists of Fragments, one list for each line
 // on the buffer's current display.
 func (b *Buffer) DisplayLines() []*list.List {
-	<-b.unlock
-	lines := make([]*list.List, b.rows)
-	dLine := getElem(b.dLines, b.scroll+1)
-	for i := range lines {
-		fragments := list.New()
-		if l := dLine; l != nil {
-			for e := l.Value.(fragList).Front(); e != nil; e = e.Next() {
-				fragments.PushBack(e.Value.(Fragment))
-			}
-			dLine = dLine.Next()
-		}
-		lines[i] = fragments
-	}
-	b.unlock <- 1
-	return lines
+	return b.view.DisplayLines()
+}
+
+// DisplayRows is like DisplayLines, but returns each row of the buffer's
+// current display with information about the line it displays.
+func (b *Buffer) DisplayRows() []DisplayRow {
+	return b.view.DisplayRows()
 }
 
 func (b *Buffer) end() Index {
 	index := Index{1, 0}
-	if b.lines.Len() > 0 {
-		index = Index{b.lines.Len(), len(b.lines.Back().Value.(lineInfo).text)}
+	if n := b.lines.Len(); n > 0 {
+		index = Index{n, b.lines.LineLen(n)}
 	}
 	return index
 }
 
+// Encoding returns the encoding used when writing the buffer's contents.
+func (b *Buffer) Encoding() Encoding {
+	<-b.unlock
+	enc := b.encoding
+	b.unlock <- 1
+	return enc
+}
+
 // End returns an Index after the last character in the Buffer.
 func (b *Buffer) End() Index {
 	<-b.unlock
@@ -341,11 +305,10 @@ func (b *Buffer) get(begin, end Index) string {
 		b.strings = make([]string, n*2)
 	}
 	lines := b.strings[:n]
-	elem := getElem(b.lines, begin.Line)
-	for i := 0; i < n; i++ {
-		lines[i] = string(elem.Value.(lineInfo).text)
-		elem = elem.Next()
-	}
+	b.lines.Walk(begin.Line, func(i int, text []rune) bool {
+		lines[i-begin.Line] = string(text)
+		return i < end.Line
+	})
 	if n > 1 {
 		lines[0] = string([]rune(lines[0])[begin.Char:])
 		lines[n-1] = string([]rune(lines[n-1])[:end.Char])
@@ -365,47 +328,7 @@ func (b *Buffer) Get(begin, end Index) string {
 
 // IndexFromCoords returns the closest index to the given display coordinates.
 func (b *Buffer) IndexFromCoords(col, row int) Index {
-	<-b.unlock
-
-	// clip values
-	if col < 0 {
-		col = 0
-	}
-	row += b.scroll + 1
-	if row > b.dLines.Len() {
-		row = b.dLines.Len()
-	} else if row < 1 {
-		row = 1
-	}
-
-	// get line
-	disp := getElem(b.dLines, row)
-	for disp.Value.(fragList).cont {
-		disp = disp.Prev()
-		col += b.cols
-	}
-	index := Index{1, 0}
-	var e *list.Element
-	for e = b.lines.Front(); e.Value.(lineInfo).disp != disp; e = e.Next() {
-		index.Line++
-	}
-
-	// get char
-	c := 0
-	for _, ch := range e.Value.(lineInfo).text {
-		if ch == '\t' {
-			c += b.tabWidth - c%b.tabWidth
-		} else {
-			c++
-		}
-		if c > col {
-			break
-		}
-		index.Char++
-	}
-
-	b.unlock <- 1
-	return index
+	return b.view.IndexFromCoords(col, row)
 }
 
 // IndexFromMark returns the current index of the mark with ID id, or a
@@ -419,57 +342,59 @@ func (b *Buffer) IndexFromMark(id int) Index {
 
 // insert performs and inseration without undo stack modification.
 func (b *Buffer) insert(index Index, text string) {
-	elem := getElem(b.lines, index.Line)
 	lines := strings.Split(text, "\n")
-	if len(lines) == 1 {
-		li := elem.Value.(lineInfo)
-		elem.Value = lineInfo{[]rune(string(li.text[:index.Char]) + lines[0] +
-			string(li.text[index.Char:])), li.disp}
-	} else {
-		firstText := elem.Value.(lineInfo).text
-		disp := elem.Value.(lineInfo).disp
-		for disp.Next() != nil && disp.Next().Value.(fragList).cont {
-			disp = disp.Next()
-		}
-		for i, line := range lines {
-			if i == 0 {
-				li := elem.Value.(lineInfo)
-				elem.Value = lineInfo{append(firstText[:index.Char],
-					[]rune(line)...), li.disp}
-			} else if i == len(lines)-1 {
-				disp = b.dLines.InsertAfter(fragList{list.New(), false}, disp)
-				elem = b.lines.InsertAfter(lineInfo{append([]rune(line),
-					firstText[index.Char:]...), disp}, elem)
-			} else {
-				disp = b.dLines.InsertAfter(fragList{list.New(), false}, disp)
-				elem = b.lines.InsertAfter(lineInfo{[]rune(line), disp}, elem)
-			}
+	b.lines.Insert(index, lines)
+	for _, v := range b.views {
+		for i := 1; i < len(lines); i++ {
+			v.dLines.Insert(index.Line+i, lineDisplay{}, 0)
 		}
+		v.moveLayout(index.Line, len(lines)-1)
+	}
+	last := utf8.RuneCountInString(lines[len(lines)-1])
+	move := func(v Index) Index {
+		return afterInsert(v, index, len(lines), last)
 	}
+	b.moveFolds(index.Line, len(lines)-1)
+	b.moveAnnotations(move)
 	b.redisplay(index.Line, index.Line+len(lines)-1)
 
+	b.moveSigns(index.Line, len(lines)-1)
+
 	// update marks
 	for k, v := range b.marks {
-		if v.Line == index.Line && v.Char >= index.Char {
-			if len(lines) == 1 {
-				v.Char += len(lines[0])
-			} else {
-				v.Char = len(lines[len(lines)-1])
-			}
-			v.Line += len(lines) - 1
-		} else if v.Line > index.Line {
-			v.Line += len(lines) - 1
+		b.marks[k] = move(v)
+	}
+	b.moveOverlays(move)
+}
+
+// afterInsert returns the position of v after text of n lines, the last of
+// which has length last, is inserted at index.
+func afterInsert(v, index Index, n, last int) Index {
+	if v.Line == index.Line && v.Char >= index.Char {
+		if n == 1 {
+			v.Char += last
+		} else {
+			v.Char += last - index.Char
 		}
-		b.marks[k] = v
+		v.Line += n - 1
+	} else if v.Line > index.Line {
+		v.Line += n - 1
 	}
+	return v
 }
 
-// Insert inserts text into the buffer at index.
+// Insert inserts text into the buffer at index. CRLF and CR line terminators
+// in text are converted to LF.
 func (b *Buffer) Insert(index Index, text string) {
+	text = normalizeEndings(text)
+	if text == "" {
+		return
+	}
 	<-b.unlock
 	index = b.clip(index)
 	b.insert(index, text)
 	runes := []rune(text)
+	b.versions++
 
 	// insert undo operation (merge with previous insertion if possible)
 	merged := false
@@ -479,24 +404,38 @@ func (b *Buffer) Insert(index Index, text string) {
 				b.undo.Remove(b.undo.Back())
 				op.end = b.shiftIndex(op.end, len(runes))
 				op.text = append(runes, op.text...)
+				op.after = b.versions
 				b.undo.PushBack(op)
 				merged = true
 			} else if op.end == index {
 				b.undo.Remove(b.undo.Back())
 				op.end = b.shiftIndex(op.end, len(runes))
 				op.text = append(op.text, runes...)
+				op.after = b.versions
 				b.undo.PushBack(op)
 				merged = true
 			}
 		}
 	}
+	end := b.shiftIndex(index, len(runes))
 	if !merged {
-		b.undo.PushBack(bufferOp{true, index, b.shiftIndex(index, len(runes)),
-			runes})
+		b.undo.PushBack(bufferOp{true, index, end, runes, b.version,
+			b.versions})
 	}
 	b.redo.Init()
+	b.version = b.versions
+	b.notify(InsertChange, index, end, runes, EditOrigin)
+
+	b.unlock <- 1
+}
 
+// LineEnding returns the style of line terminator used when writing the
+// buffer's contents.
+func (b *Buffer) LineEnding() LineEnding {
+	<-b.unlock
+	le := b.lineEnding
 	b.unlock <- 1
+	return le
 }
 
 // Mark sets a mark with ID id at index. The mark's position is automatically
@@ -511,17 +450,115 @@ func (b *Buffer) Mark(index Index, id ...int) {
 	b.unlock <- 1
 }
 
+// MixedLineEndings returns true if and only if the contents most recently
+// loaded by ReadFrom contained more than one style of line terminator. Such
+// contents are written back using only the style returned by LineEnding.
+func (b *Buffer) MixedLineEndings() bool {
+	<-b.unlock
+	mixed := b.mixed
+	b.unlock <- 1
+	return mixed
+}
+
 // Modified returns true if and only if the buffer's contents differ from the
-// contents at the last time ResetModified was called. This operation is
-// expsensive, since it must hash the entire buffer contents.
+// contents at the last time ResetModified was called. Contents restored by
+// undoing or redoing operations are considered unmodified, but contents
+// restored by other insertions and deletions are not; use Checksum to
+// compare contents directly.
 func (b *Buffer) Modified() bool {
-	checksum := md5.Sum([]byte(b.Get(Index{1, 0}, b.End())))
 	<-b.unlock
-	val := checksum != b.checksum
+	val := b.version != b.saved
 	b.unlock <- 1
 	return val
 }
 
+// ReadFrom replaces the contents of the buffer with data read from r until
+// EOF, and returns the number of bytes read. The encoding of the data is
+// guessed using DetectEncoding, and becomes the buffer's encoding. The data
+// is read line by line, so the complete contents never need to be held in a
+// single string; if the buffer uses PieceTableStorage and the data is UTF-8,
+// the data is instead kept as read and referred to by the buffer's lines.
+// LF, CRLF and CR line terminators are all recognized, and the buffer's line
+// ending is set to the most frequent of them. The undo and redo stacks are
+// cleared, and the comparison point for Modified is set to the loaded
+// contents. If an error other than EOF is encountered, including a
+// *DecodeError for data that is invalid in the encoding, the buffer contains
+// the lines read up to that point.
+func (b *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
+	return b.ReadFromEncoding(r, nil)
+}
+
+// ReadFromEncoding is like ReadFrom, except that the data is decoded using
+// enc instead of a guessed encoding. If enc is nil, the encoding is guessed.
+// A leading byte order mark for enc is skipped.
+func (b *Buffer) ReadFromEncoding(r io.Reader, enc Encoding) (n int64,
+	err error) {
+	<-b.unlock
+	b.lines.Init()
+	br := bufio.NewReader(r)
+	if enc == nil {
+		p, _ := br.Peek(4096) // sample for detection
+		enc = DetectEncoding(p)
+	}
+	if bom := enc.BOM(); len(bom) > 0 {
+		if p, _ := br.Peek(len(bom)); bytes.Equal(p, bom) {
+			br.Discard(len(bom))
+			n += int64(len(bom))
+		}
+	}
+	var counts [3]int
+	if s, ok := b.lines.(*pieceStore); ok && (enc == UTF8 || enc == UTF8BOM) {
+		var m int64
+		m, err = s.load(br, br.Buffered()+remaining(r), &counts)
+		if e, ok := err.(*DecodeError); ok {
+			e.Offset += n
+			e.Encoding = enc
+		}
+		n += m
+	} else {
+		d := &decoder{r: br, enc: enc, offset: n}
+		for {
+			text, le, m, e := readLine(d)
+			n += int64(m)
+			b.lines.PushBack(text)
+			if le == noEnding {
+				err = e
+				break
+			}
+			counts[le]++
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	b.encoding = enc
+	b.lineEnding, b.mixed = dominantEnding(counts)
+	b.versions++
+	b.version, b.saved = b.versions, b.versions
+	b.folds = make(map[int]fold)
+	b.foldSpans = nil
+	b.moveAnnotations(b.clip)
+	for _, v := range b.views {
+		v.reset()
+	}
+	b.undo.Init()
+	b.redo.Init()
+	for k, v := range b.marks {
+		b.marks[k] = b.clip(v)
+	}
+	for id, s := range b.signs {
+		s.line = b.clip(Index{s.line, 0}).Line
+		b.signs[id] = s
+	}
+	b.moveOverlays(b.clip)
+	for _, v := range b.views {
+		v.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	}
+	b.notify(LoadChange, Index{1, 0}, b.end(), nil, EditOrigin)
+	b.unlock <- 1
+	return
+}
+
 // Redo redoes the last undone sequence of insertions and deletions and returns
 // true, or returns false if the redo stack is empty. The given marks are
 // positioned at the index of the redone operation.
@@ -538,13 +575,16 @@ func (b *Buffer) Redo(mark ...int) bool {
 					for _, id := range mark {
 						b.marks[id] = v.end
 					}
+					b.notify(InsertChange, v.start, v.end, v.text, RedoOrigin)
 				} else {
 					b.delete(v.start, v.end)
 					for _, id := range mark {
 						b.marks[id] = v.start
 					}
+					b.notify(DeleteChange, v.start, v.end, v.text, RedoOrigin)
 				}
 				opRedone = true
+				b.version = v.after
 				b.undo.PushBack(v)
 			case separator:
 				if opRedone {
@@ -561,11 +601,10 @@ func (b *Buffer) Redo(mark ...int) bool {
 }
 
 // ResetModified sets the comparison point for future calls to Modified to the
-// current contents of the buffer. This operation is expensive, since it must
-// hash the entire buffer contents.
+// current contents of the buffer.
 func (b *Buffer) ResetModified() {
 	<-b.unlock
-	b.checksum = md5.Sum([]byte(b.get(Index{1, 0}, b.end())))
+	b.saved = b.version
 	b.unlock <- 1
 }
 
@@ -577,62 +616,76 @@ func (b *Buffer) ResetUndo() {
 	b.unlock <- 1
 }
 
-func (b *Buffer) scrollWithoutLock(delta int) {
-	b.scroll += delta
-	if b.scroll < 0 || b.dLines.Len() < b.rows {
-		b.scroll = 0
-	} else if b.scroll+b.rows > b.dLines.Len() {
-		b.scroll = b.dLines.Len() - b.rows
-	}
-}
-
 // Scroll scrolls the buffer's display down by delta lines.
 func (b *Buffer) Scroll(delta int) {
-	<-b.unlock
-	b.scrollWithoutLock(delta)
-	b.unlock <- 1
+	b.view.Scroll(delta)
+}
+
+// See scrolls the buffer's display so that index is visible, following
+// policy.
+func (b *Buffer) See(index Index, policy SeePolicy) {
+	b.view.See(index, policy)
+}
+
+// ScrollColumns scrolls the buffer's display right by delta columns, if lines
+// are not wrapped. The display cannot be scrolled left of the first column.
+func (b *Buffer) ScrollColumns(delta int) {
+	b.view.ScrollColumns(delta)
+}
+
+// HorizontalScroll returns the number of columns the buffer's display is
+// scrolled right.
+func (b *Buffer) HorizontalScroll() int {
+	return b.view.HorizontalScroll()
 }
 
 // ScrollFraction returns a number in the range [0, 1] describing the vertical
 // scroll fraction of the buffer display. If the entire content is visible, -1
-// is returned instead.
+// is returned instead. The whole buffer must be laid out to find its number of
+// rows, so the first call after the buffer is loaded can be slow.
 func (b *Buffer) ScrollFraction() float64 {
-	<-b.unlock
-	f := -1.0
-	if b.rows < b.dLines.Len() {
-		f = float64(b.scroll) / float64(b.dLines.Len()-b.rows)
-	}
-	b.unlock <- 1
-	return f
+	return b.view.ScrollFraction()
 }
 
-// Separate inserts a separator onto the undo stack in order to delimit
-// sequences of insertions and deletions.
-func (b *Buffer) Separate() {
-	<-b.unlock
+// separate inserts a separator onto the undo stack if the last element of the
+// stack is an operation.
+func (b *Buffer) separate() {
 	if b.undo.Len() != 0 {
 		if _, ok := b.undo.Back().Value.(bufferOp); ok {
 			b.undo.PushBack(separator{})
 		}
 	}
+}
+
+// Separate inserts a separator onto the undo stack in order to delimit
+// sequences of insertions and deletions.
+func (b *Buffer) Separate() {
+	<-b.unlock
+	b.separate()
 	b.unlock <- 1
 }
 
-// SetSize sets the display size of the buffer.
-func (b *Buffer) SetSize(cols, rows int) {
+// SetEncoding sets the encoding used when writing the buffer's contents to
+// enc.
+func (b *Buffer) SetEncoding(enc Encoding) {
 	<-b.unlock
-	b.cols, b.rows = cols, rows
-	if b.cols < 1 {
-		b.cols = 1
-	}
-	if b.rows < 0 {
-		b.rows = 0
-	}
-	b.resize()
-	b.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	b.encoding = enc
 	b.unlock <- 1
 }
 
+// SetLineEnding sets the style of line terminator used when writing the
+// buffer's contents to le.
+func (b *Buffer) SetLineEnding(le LineEnding) {
+	<-b.unlock
+	b.lineEnding = le
+	b.unlock <- 1
+}
+
+// SetSize sets the display size of the buffer.
+func (b *Buffer) SetSize(cols, rows int) {
+	b.view.SetSize(cols, rows)
+}
+
 // SetSyntax sets the syntax highlighting rules for the buffer to rules.
 func (b *Buffer) SetSyntax(rules []Rule) {
 	<-b.unlock
@@ -644,35 +697,31 @@ func (b *Buffer) SetSyntax(rules []Rule) {
 		b.syntax[i] = rule
 	}
 	b.syntax = b.syntax[:len(rules)]
-	b.redisplay(1, b.lines.Len())
-	b.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	b.syntaxVersion++
+	b.invalidate(1)
 	b.unlock <- 1
 }
 
+// SetWrap sets how lines wider than the display are wrapped.
+func (b *Buffer) SetWrap(opts WrapOptions) {
+	b.view.SetWrap(opts)
+}
+
 // SetTabWidth sets the tab width of the buffer to cols.
 func (b *Buffer) SetTabWidth(cols int) {
-	<-b.unlock
-	prevWidth := b.tabWidth
-	b.tabWidth = cols
-	if prevWidth != cols {
-		b.redisplay(1, b.lines.Len())
-		b.scrollWithoutLock(0) // make sure scroll isn't out of bounds
-	}
-	b.unlock <- 1
+	b.view.SetTabWidth(cols)
 }
 
 // shiftIndex shitfs and index without locking the buffer.
 func (b *Buffer) shiftIndex(index Index, chars int) Index {
 	index = b.clip(index)
-	elem := getElem(b.lines, index.Line)
 	for chars < 0 {
 		if index.Char == 0 {
 			if index.Line == 1 {
 				chars = 0
 			} else {
 				index.Line--
-				elem = elem.Prev()
-				index.Char = len(elem.Value.(lineInfo).text)
+				index.Char = b.lines.LineLen(index.Line)
 				chars++
 			}
 		} else if -chars > index.Char {
@@ -684,14 +733,13 @@ func (b *Buffer) shiftIndex(index Index, chars int) Index {
 		}
 	}
 	for chars > 0 {
-		lineLen := len(elem.Value.(lineInfo).text)
+		lineLen := b.lines.LineLen(index.Line)
 		if index.Char == lineLen {
 			if index.Line == b.lines.Len() {
 				chars = 0
 			} else {
 				index.Line++
 				index.Char = 0
-				elem = elem.Next()
 				chars--
 			}
 		} else if chars > lineLen-index.Char {
@@ -705,6 +753,58 @@ func (b *Buffer) shiftIndex(index Index, chars int) Index {
 	return index
 }
 
+// shiftClusters is like shiftIndex, but shifts by grapheme clusters.
+func (b *Buffer) shiftClusters(index Index, clusters int) Index {
+	index = b.snap(index)
+	text := b.lines.Line(index.Line)
+	for ; clusters < 0; clusters++ {
+		if index.Char > 0 {
+			index.Char, _ = clusterAt(text, index.Char-1)
+		} else if index.Line > 1 {
+			index.Line--
+			text = b.lines.Line(index.Line)
+			index.Char = len(text)
+		} else {
+			break
+		}
+	}
+	for ; clusters > 0; clusters-- {
+		if index.Char < len(text) {
+			_, index.Char = clusterAt(text, index.Char)
+		} else if index.Line < b.lines.Len() {
+			index.Line++
+			text = b.lines.Line(index.Line)
+			index.Char = 0
+		} else {
+			break
+		}
+	}
+	return index
+}
+
+// snap returns the index of the beginning of the grapheme cluster containing
+// index.
+func (b *Buffer) snap(index Index) Index {
+	index = b.clip(index)
+	if index.Char > 0 {
+		index.Char, _ = clusterAt(b.lines.Line(index.Line), index.Char)
+	}
+	return index
+}
+
+// snapEnd is like snap, but returns the index of the end of the cluster if
+// index is inside it.
+func (b *Buffer) snapEnd(index Index) Index {
+	index = b.clip(index)
+	if index.Char > 0 {
+		begin, end := clusterAt(b.lines.Line(index.Line), index.Char)
+		if begin != index.Char {
+			index.Char = end
+		}
+	}
+	return index
+}
+
 // ShiftIndex returns index shifted right by chars. If chars is negative, index
 // is shifted left.
 func (b *Buffer) ShiftIndex(index Index, chars int) Index {
@@ -714,6 +814,34 @@ func (b *Buffer) ShiftIndex(index Index, chars int) Index {
 	return index
 }
 
+// ShiftClusters returns index shifted right by the given number of grapheme
+// clusters, or user-perceived characters, as defined by Unicode Standard
+// Annex #29. If clusters is negative, index is shifted left. A line break
+// counts as one cluster, and an index inside a cluster is first moved to the
+// beginning of the cluster.
+func (b *Buffer) ShiftClusters(index Index, clusters int) Index {
+	<-b.unlock
+	index = b.shiftClusters(index, clusters)
+	b.unlock <- 1
+	return index
+}
+
+// SnapIndex returns the index of the beginning of the grapheme cluster
+// containing index, so that a flag emoji or a letter and its combining marks
+// are not divided. An index at a cluster boundary is returned unchanged.
+func (b *Buffer) SnapIndex(index Index) Index {
+	<-b.unlock
+	index = b.snap(index)
+	b.unlock <- 1
+	return index
+}
+
+// VisibleRange returns the indexes of the beginning of the first row and the
+// end of the last row on the buffer's display.
+func (b *Buffer) VisibleRange() (begin, end Index) {
+	return b.view.VisibleRange()
+}
+
 // Undo undoes the last sequence of insertions and deletions and returns true,
 // or returns false if the redo stack is empty. The given marks are positioned
 // at the index of the undone operation.
@@ -730,13 +858,16 @@ func (b *Buffer) Undo(mark ...int) bool {
 					for _, id := range mark {
 						b.marks[id] = v.start
 					}
+					b.notify(DeleteChange, v.start, v.end, v.text, UndoOrigin)
 				} else {
 					b.insert(v.start, string(v.text))
 					for _, id := range mark {
 						b.marks[id] = v.end
 					}
+					b.notify(InsertChange, v.start, v.end, v.text, UndoOrigin)
 				}
 				opUndone = true
+				b.version = v.before
 				b.redo.PushBack(v)
 			case separator:
 				if opUndone {
@@ -752,6 +883,48 @@ func (b *Buffer) Undo(mark ...int) bool {
 	return false
 }
 
+// WriteTo writes the contents of the buffer to w line by line in the
+// buffer's encoding, terminating lines with the buffer's line ending, and
+// returns the number of bytes written. If the encoding has a byte order mark,
+// it is written first. If a rune cannot be represented in the encoding, an
+// *EncodeError is returned.
+func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	<-b.unlock
+	bw := bufio.NewWriter(w)
+	var m int
+	m, err = bw.Write(b.encoding.BOM())
+	n += int64(m)
+	var ending, p []byte
+	for _, ch := range b.lineEnding.String() {
+		ending, _ = b.encoding.AppendRune(ending, ch)
+	}
+	b.lines.Walk(1, func(i int, text []rune) bool {
+		if err != nil {
+			return false
+		}
+		p = p[:0]
+		if i > 1 {
+			p = append(p, ending...)
+		}
+		for j, ch := range text {
+			var ok bool
+			if p, ok = b.encoding.AppendRune(p, ch); !ok {
+				err = &EncodeError{Index{i, j}, ch, b.encoding}
+				return false
+			}
+		}
+		m, err = bw.Write(p)
+		n += int64(m)
+		return err == nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	n -= int64(bw.Buffered()) // not written to w
+	b.unlock <- 1
+	return
+}
+
 // Index denotes a position in a Buffer.
 type Index struct {
 	Line, Char int
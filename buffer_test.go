@@ -1,8 +1,12 @@
 package edit
 
 import (
+	"bytes"
 	"container/list"
+	"crypto/md5"
+	"errors"
 	"math/rand"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -59,6 +63,7 @@ func TestBuffer(t *testing.T) {
 	if b.Modified() {
 		t.Errorf("Modified returned true directly after ResetModified")
 	}
+	b.Separate()
 
 	// Delete tests
 	b.Delete(Index{1, 0}, Index{1, 0}) // Delete nothing
@@ -80,6 +85,42 @@ func TestBuffer(t *testing.T) {
 	if !b.Modified() {
 		t.Errorf("Modified returned false for modified buffer")
 	}
+
+	// Modified after undo and redo
+	b.Undo()
+	if b.Modified() {
+		t.Errorf("Modified returned true after undoing to saved contents")
+	}
+	b.Redo()
+	if !b.Modified() {
+		t.Errorf("Modified returned false after redo")
+	}
+	b.Undo()
+	b.Insert(b.End(), "!")
+	b.Delete(b.ShiftIndex(b.End(), -1), b.End())
+	if !b.Modified() {
+		t.Errorf("Modified returned false after insertion and deletion")
+	}
+
+	// Modified after edits that change nothing
+	b.ResetModified()
+	changes := 0
+	b.Listen(func(Change) { changes++ })
+	b.Insert(b.End(), "")
+	b.Delete(Index{b.End().Line + 1, 0}, Index{b.End().Line + 2, 0})
+	b.Delete(b.End(), b.ShiftIndex(b.End(), -1))
+	if b.Modified() {
+		t.Errorf("Modified returned true after no-op edits")
+	}
+	if changes != 0 {
+		t.Errorf("no-op edits notified %d changes; want 0", changes)
+	}
+
+	// Checksum
+	want = b.Get(Index{1, 0}, b.End())
+	if md5.Sum([]byte(want)) != b.Checksum() {
+		t.Errorf("Checksum returned wrong sum")
+	}
 }
 
 func TestBufferDisplay(t *testing.T) {
@@ -129,6 +170,61 @@ func TestBufferDisplay(t *testing.T) {
 	}
 }
 
+// displayer is a Buffer or View.
+type displayer interface {
+	DisplayLines() []*list.List
+}
+
+// displayFragments returns the fragments of each line on d's display.
+func displayFragments(d displayer) [][]Fragment {
+	var rows [][]Fragment
+	for _, dLine := range d.DisplayLines() {
+		var row []Fragment
+		for e := dLine.Front(); e != nil; e = e.Next() {
+			row = append(row, e.Value.(Fragment))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestBufferRegionSyntax(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(20, 5)
+	commentRule, _ := NewRegionRule(`/\*`, `\*/`, 1)
+	b.SetSyntax([]Rule{commentRule})
+	b.Insert(b.End(), "a /* b\nc\nd */ e\nf")
+	want := [][]Fragment{{{"a ", noneTag}, {"/* b", 1}}, {{"c", 1}},
+		{{"d */", 1}, {" e", noneTag}}, {{"f", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines returned %v; want %v", got, want)
+	}
+
+	// Removing the start of the region changes following lines
+	b.Delete(Index{1, 2}, Index{1, 4})
+	want = [][]Fragment{{{"a  b", noneTag}}, {{"c", noneTag}},
+		{{"d */ e", noneTag}}, {{"f", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines returned %v; want %v", got, want)
+	}
+
+	// So does inserting it on a new line
+	b.Insert(Index{2, 0}, "x\n/*")
+	want = [][]Fragment{{{"a  b", noneTag}}, {{"x", noneTag}}, {{"/*c", 1}},
+		{{"d */", 1}, {" e", noneTag}}, {{"f", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines returned %v; want %v", got, want)
+	}
+
+	// And deleting across lines
+	b.Delete(Index{3, 2}, Index{4, 1})
+	want = [][]Fragment{{{"a  b", noneTag}}, {{"x", noneTag}},
+		{{"/* */", 1}, {" e", noneTag}}, {{"f", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines returned %v; want %v", got, want)
+	}
+}
+
 func TestBufferShiftIndex(t *testing.T) {
 	b := NewBuffer()
 	b.Insert(b.End(), testSource)
@@ -152,6 +248,46 @@ func TestBufferShiftIndex(t *testing.T) {
 	}
 }
 
+func TestBufferShiftClusters(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "ae\u0301🇯🇵\nx")
+	for _, c := range []struct {
+		index    Index
+		clusters int
+		want     Index
+	}{
+		{Index{1, 0}, 0, Index{1, 0}},
+		{Index{1, 0}, 2, Index{1, 3}},
+		{Index{1, 2}, 1, Index{1, 3}},  // from inside a cluster
+		{Index{1, 4}, -1, Index{1, 1}}, // from inside a cluster
+		{Index{1, 5}, 1, Index{2, 0}},
+		{Index{2, 0}, -2, Index{1, 3}},
+		{Index{1, 0}, 10, Index{2, 1}},
+		{Index{2, 1}, -10, Index{1, 0}},
+	} {
+		if got := b.ShiftClusters(c.index, c.clusters); c.want != got {
+			t.Errorf("ShiftClusters(%v, %v) == %v; want %v", c.index,
+				c.clusters, got, c.want)
+		}
+	}
+	if want, got := (Index{1, 3}), b.SnapIndex(Index{1, 4}); want != got {
+		t.Errorf("SnapIndex() == %v; want %v", got, want)
+	}
+	if want, got := (Index{1, 1}), b.SnapIndex(Index{1, 1}); want != got {
+		t.Errorf("SnapIndex() == %v; want %v", got, want)
+	}
+
+	// Deleting part of a cluster deletes all of it
+	b.Delete(b.ShiftIndex(Index{1, 5}, -1), Index{1, 5})
+	if want, got := "ae\u0301\nx", b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %+q; want %+q", got, want)
+	}
+	b.Delete(Index{1, 0}, Index{1, 2})
+	if want, got := "\nx", b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %+q; want %+q", got, want)
+	}
+}
+
 func TestBufferMark(t *testing.T) {
 	// invalid ID
 	b := NewBuffer()
@@ -216,6 +352,179 @@ func TestBufferIndexCoords(t *testing.T) {
 	}
 }
 
+func TestBufferWideDisplay(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(5, 5)
+	b.Insert(b.End(), "日本語ab\ne\u0301x\n👩\u200d💻z")
+
+	// wide characters are not split across rows
+	want := [][]Fragment{{{"日本", noneTag}}, {{"語ab", noneTag}},
+		{{"e\u0301x", noneTag}}, {{"👩\u200d💻z", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	for _, c := range []struct {
+		index    Index
+		col, row int
+	}{
+		{Index{1, 1}, 2, 0}, {Index{1, 2}, 0, 1}, {Index{1, 4}, 3, 1},
+		{Index{1, 5}, 4, 1}, {Index{2, 2}, 1, 2}, {Index{3, 3}, 2, 3},
+	} {
+		if col, row := b.CoordsFromIndex(c.index); c.col != col || c.row != row {
+			t.Errorf("CoordsFromIndex(%v) == %v, %v; want %v, %v", c.index,
+				col, row, c.col, c.row)
+		}
+		if got := b.IndexFromCoords(c.col, c.row); c.index != got {
+			t.Errorf("IndexFromCoords(%v, %v) == %v; want %v", c.col, c.row,
+				got, c.index)
+		}
+	}
+	for _, c := range []struct {
+		col, row int
+		index    Index
+	}{
+		{1, 0, Index{1, 0}}, {4, 0, Index{1, 2}}, {3, 2, Index{2, 3}},
+		{1, 3, Index{3, 0}},
+	} {
+		if got := b.IndexFromCoords(c.col, c.row); c.index != got {
+			t.Errorf("IndexFromCoords(%v, %v) == %v; want %v", c.col, c.row,
+				got, c.index)
+		}
+	}
+}
+
+// limitedWriter is an io.Writer that fails after max bytes are written.
+type limitedWriter struct {
+	n, max int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.n+len(p) > w.max {
+		m := w.max - w.n
+		w.n = w.max
+		return m, errors.New("write limit reached")
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestBufferReadWrite(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "old text")
+	b.Mark(b.End(), 0)
+
+	// ReadFrom
+	if n, err := b.ReadFrom(strings.NewReader(testSource)); err != nil {
+		t.Errorf("ReadFrom() returned error %v", err)
+	} else if want, got := int64(len(testSource)), n; want != got {
+		t.Errorf("ReadFrom() == %v; want %v", got, want)
+	}
+	if want, got := testSource, b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %#v; want %#v", got, want)
+	}
+	if want, got := (Index{1, 8}), b.IndexFromMark(0); want != got {
+		t.Errorf("IndexFromMark() == %v; want %v", got, want)
+	}
+	if b.Modified() {
+		t.Error("Modified() returned true after ReadFrom")
+	}
+	if b.Undo() {
+		t.Error("Undo() returned true after ReadFrom")
+	}
+
+	// WriteTo
+	var buf bytes.Buffer
+	if n, err := b.WriteTo(&buf); err != nil {
+		t.Errorf("WriteTo() returned error %v", err)
+	} else if want, got := int64(len(testSource)), n; want != got {
+		t.Errorf("WriteTo() == %v; want %v", got, want)
+	}
+	if want, got := testSource, buf.String(); want != got {
+		t.Errorf("WriteTo() wrote %#v; want %#v", got, want)
+	}
+	lw := &limitedWriter{max: 10}
+	if n, err := b.WriteTo(lw); err == nil {
+		t.Error("WriteTo() did not return error for failed write")
+	} else if want, got := int64(lw.n), n; want != got {
+		t.Errorf("WriteTo() == %v; want %v", got, want)
+	}
+
+	// line endings
+	crlfSource := strings.Replace(testSource, "\n", "\r\n", -1)
+	b.ReadFrom(strings.NewReader(crlfSource))
+	if want, got := testSource, b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %#v; want %#v", got, want)
+	}
+	if want, got := CRLF, b.LineEnding(); want != got {
+		t.Errorf("LineEnding() == %v; want %v", got, want)
+	}
+	if b.MixedLineEndings() {
+		t.Error("MixedLineEndings() returned true for CRLF source")
+	}
+	buf.Reset()
+	b.WriteTo(&buf)
+	if want, got := crlfSource, buf.String(); want != got {
+		t.Errorf("WriteTo() wrote %#v; want %#v", got, want)
+	}
+	b.SetLineEnding(CR)
+	buf.Reset()
+	b.WriteTo(&buf)
+	crSource := strings.Replace(testSource, "\n", "\r", -1)
+	if want, got := crSource, buf.String(); want != got {
+		t.Errorf("WriteTo() wrote %#v; want %#v", got, want)
+	}
+	b.ReadFrom(strings.NewReader("a\r\nb\nc\r\n"))
+	if want, got := CRLF, b.LineEnding(); want != got {
+		t.Errorf("LineEnding() == %v; want %v", got, want)
+	}
+	if !b.MixedLineEndings() {
+		t.Error("MixedLineEndings() returned false for mixed source")
+	}
+	b.Insert(b.End(), "d\r\ne\rf")
+	want := "a\nb\nc\nd\ne\nf"
+	if got := b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %#v; want %#v", got, want)
+	}
+
+	// encodings
+	for _, enc := range []Encoding{UTF8BOM, UTF16LEBOM, UTF16BE, Latin1} {
+		var src []byte
+		src = append(src, enc.BOM()...)
+		for _, ch := range "caf\u00e9\r\n" {
+			src, _ = enc.AppendRune(src, ch)
+		}
+		b.ReadFrom(bytes.NewReader(src))
+		if want, got := enc, b.Encoding(); want != got {
+			t.Errorf("Encoding() == %v; want %v", got, want)
+		}
+		if want, got := "caf\u00e9\n", b.Get(Index{1, 0}, b.End()); want != got {
+			t.Errorf("Get() == %#v; want %#v", got, want)
+		}
+		buf.Reset()
+		b.WriteTo(&buf)
+		if !bytes.Equal(src, buf.Bytes()) {
+			t.Errorf("WriteTo() wrote %#v; want %#v", buf.Bytes(), src)
+		}
+	}
+	b.Insert(b.End(), "\u20ac")
+	if _, err := b.WriteTo(&buf); err == nil {
+		t.Error("WriteTo() did not return error for unencodable rune")
+	} else if e, ok := err.(*EncodeError); !ok || e.Index != (Index{2, 0}) {
+		t.Errorf("WriteTo() returned error %#v; want index 2.0", err)
+	}
+	_, err := b.ReadFromEncoding(strings.NewReader("ok\n\xff"), UTF8)
+	if e, ok := err.(*DecodeError); !ok || e.Offset != 3 {
+		t.Errorf("ReadFromEncoding() returned error %#v; want offset 3", err)
+	}
+
+	// empty input
+	b.ReadFrom(strings.NewReader(""))
+	if want, got := (Index{1, 0}), b.End(); want != got {
+		t.Errorf("End() == %v; want %v", got, want)
+	}
+}
+
 func TestBufferScroll(t *testing.T) {
 	b := NewBuffer()
 	b.SetSize(80, 1)
@@ -379,12 +688,53 @@ func randIndexes(b *Buffer, n, maxLines int) []Index {
 	return indexes
 }
 
+// randNearIndexes is like randIndexes, except that each end index is chosen
+// relative to its begin index, which is faster for large buffers.
+func randNearIndexes(b *Buffer, n, maxLines int) []Index {
+	indexes := make([]Index, n*2)
+	for i := 0; i < n*2; i += 2 {
+		line := 1 + rand.Int()%b.lines.Len()
+		begin := b.clip(Index{line, rand.Int() % benchMaxLine})
+		end := b.clip(Index{line + rand.Int()%(maxLines+1),
+			rand.Int() % benchMaxLine})
+		if end.Less(begin) {
+			begin, end = end, begin
+		}
+		indexes[i], indexes[i+1] = begin, end
+	}
+	return indexes
+}
+
 const (
 	benchBufLines = 2000 // Lines in a benchmarking buffer
 	benchOpLines  = 25   // Maximum lines in a benchmarking operation
 	benchMaxLine  = 80   // Maximum characters in a benchmarking line
+
+	benchLargeBufLines = 1000000 // Lines in a large benchmarking buffer
 )
 
+var largeBuf *Buffer // Shared by large buffer benchmarks
+
+// largeBuffer returns a buffer of benchLargeBufLines random lines, loaded
+// with ReadFrom.
+func largeBuffer() *Buffer {
+	if largeBuf == nil {
+		var src bytes.Buffer
+		line := make([]byte, benchMaxLine)
+		for i := 0; i < benchLargeBufLines; i++ {
+			lineLen := rand.Int() % benchMaxLine
+			for j := 0; j < lineLen; j++ {
+				line[j] = byte(0x20 + rand.Int()%0x5f)
+			}
+			src.Write(line[:lineLen])
+			src.WriteByte('\n')
+		}
+		largeBuf = NewBuffer()
+		largeBuf.ReadFrom(&src)
+	}
+	return largeBuf
+}
+
 // Current benchmark: 30000 ns/op
 func BenchmarkBufferCoordsFromIndex(b *testing.B) {
 	buf := randBuffer(benchBufLines)
@@ -468,7 +818,7 @@ func BenchmarkBufferInsert(b *testing.B) {
 	}
 }
 
-// Current benchmark: 4400000 ns/op (1500000 ns/op before []rune)
+// Current benchmark: 78 ns/op (4400000 ns/op before version counter)
 func BenchmarkBufferModified(b *testing.B) {
 	buf := randBuffer(benchBufLines)
 	b.ResetTimer()
@@ -477,7 +827,7 @@ func BenchmarkBufferModified(b *testing.B) {
 	}
 }
 
-// Current benchmark: 4400000 ns/op (1500000 ns/op before []rune)
+// Current benchmark: 77 ns/op (4400000 ns/op before version counter)
 func BenchmarkBufferResetModified(b *testing.B) {
 	buf := randBuffer(benchBufLines)
 	b.ResetTimer()
@@ -536,3 +886,53 @@ func BenchmarkBufferShiftIndex(b *testing.B) {
 		buf.ShiftIndex(indexes[i], rand.Int()%51-25)
 	}
 }
+
+// Current benchmark: 3800 ns/op (23 ms/op before tree)
+func BenchmarkLargeBufferCoordsFromIndex(b *testing.B) {
+	buf := largeBuffer()
+	indexes := randNearIndexes(buf, b.N/2+1, benchOpLines)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.CoordsFromIndex(indexes[i])
+	}
+}
+
+// Current benchmark: 13000 ns/op (18 ms/op before tree)
+func BenchmarkLargeBufferGet(b *testing.B) {
+	buf := largeBuffer()
+	indexes := randNearIndexes(buf, b.N, benchOpLines)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Get(indexes[i*2], indexes[i*2+1])
+	}
+}
+
+// Current benchmark: 6600 ns/op (19 ms/op before tree)
+func BenchmarkLargeBufferIndexFromCoords(b *testing.B) {
+	buf := largeBuffer()
+	coords := make([][]int, b.N)
+	for i := 0; i < b.N; i++ {
+		coords[i] = []int{rand.Int() % benchMaxLine,
+			rand.Int() % benchLargeBufLines}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.IndexFromCoords(coords[i][0], coords[i][1])
+	}
+}
+
+// Current benchmark: 120000 ns/op (40 ms/op before tree)
+func BenchmarkLargeBufferInsert(b *testing.B) {
+	buf := largeBuffer()
+	indexes := randNearIndexes(buf, b.N, benchOpLines)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		text := buf.Get(indexes[i*2], indexes[i*2+1])
+		b.StartTimer()
+		buf.Insert(indexes[i*2], text)
+		b.StopTimer()
+		buf.Delete(indexes[i*2], indexes[i*2+1])
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,168 @@
+package edit
+
+// ChangeKind denotes a kind of change to the contents of a Buffer.
+type ChangeKind int
+
+// Kinds of change.
+const (
+	InsertChange ChangeKind = iota // text was inserted
+	DeleteChange                   // text was deleted
+	LoadChange                     // the entire contents were replaced
+)
+
+// ChangeOrigin denotes the cause of a change to the contents of a Buffer.
+type ChangeOrigin int
+
+// Origins of change.
+const (
+	EditOrigin ChangeOrigin = iota // Insert, Delete, or ReadFrom
+	UndoOrigin                     // Undo
+	RedoOrigin                     // Redo
+)
+
+// Change describes a modification of the contents of a Buffer. For an
+// insertion, Begin and End delimit the inserted text after the insertion. For
+// a deletion, Begin and End delimit the deleted text before the deletion. For
+// a load, Begin and End delimit the new contents of the buffer, and Text is
+// empty.
+type Change struct {
+	Kind       ChangeKind
+	Begin, End Index
+	Text       string // inserted or deleted text
+	Origin     ChangeOrigin
+}
+
+type listener struct {
+	id int
+	fn func(Change)
+}
+
+// notify calls the buffer's listeners with a change.
+func (b *Buffer) notify(kind ChangeKind, begin, end Index, text []rune,
+	origin ChangeOrigin) {
+	if len(b.listeners) == 0 {
+		return
+	}
+	c := Change{kind, begin, end, string(text), origin}
+	for _, l := range b.listeners {
+		l.fn(c)
+	}
+}
+
+// Listen registers fn to be called with each change to the contents of the
+// buffer, and returns an ID that can be passed to Unlisten. Listeners are
+// called in the order they were registered. Since fn is called while the
+// buffer is locked, it must not call methods of the buffer.
+func (b *Buffer) Listen(fn func(Change)) int {
+	<-b.unlock
+	b.nextListener++
+	id := b.nextListener
+	b.listeners = append(b.listeners, listener{id, fn})
+	b.unlock <- 1
+	return id
+}
+
+// Unlisten unregisters the listener with ID id.
+func (b *Buffer) Unlisten(id int) {
+	<-b.unlock
+	for i, l := range b.listeners {
+		if l.id == id {
+			b.listeners = append(b.listeners[:i:i], b.listeners[i+1:]...)
+			break
+		}
+	}
+	b.unlock <- 1
+}
+
+// subscription queues changes for delivery on a channel.
+type subscription struct {
+	c       chan Change
+	id      int      // listener ID
+	pending []Change // changes not yet sent
+	unlock  chan int // used as mutex for pending
+	signal  chan int // signals that pending is non-empty
+	done    chan int // closed on unsubscription
+	stopped chan int // closed when run returns
+}
+
+func (s *subscription) push(c Change) {
+	<-s.unlock
+	s.pending = append(s.pending, c)
+	s.unlock <- 1
+	select {
+	case s.signal <- 1:
+	default:
+	}
+}
+
+// run sends pending changes on the subscription's channel until the
+// subscription is cancelled, then closes the channel.
+func (s *subscription) run() {
+	defer close(s.stopped)
+	defer close(s.c)
+	for {
+		select {
+		case <-s.signal:
+		case <-s.done:
+			return
+		}
+		<-s.unlock
+		pending := s.pending
+		s.pending = nil
+		s.unlock <- 1
+		for _, c := range pending {
+			select {
+			case <-s.done: // takes precedence over a ready receiver
+				return
+			default:
+			}
+			select {
+			case s.c <- c:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel on which each change to the contents of the
+// buffer is sent, in order. Changes are queued, so modifying the buffer never
+// blocks on a slow receiver. The channel is closed by Unsubscribe.
+func (b *Buffer) Subscribe() <-chan Change {
+	s := &subscription{
+		c:       make(chan Change),
+		unlock:  make(chan int, 1),
+		signal:  make(chan int, 1),
+		done:    make(chan int),
+		stopped: make(chan int),
+	}
+	s.unlock <- 1
+	s.id = b.Listen(s.push)
+	<-b.unlock
+	b.subscriptions = append(b.subscriptions, s)
+	b.unlock <- 1
+	go s.run()
+	return s.c
+}
+
+// Unsubscribe stops delivery of changes on c, a channel returned by
+// Subscribe, and closes it. Changes not yet received are discarded, so once
+// Unsubscribe returns, receiving from c never yields another change.
+func (b *Buffer) Unsubscribe(c <-chan Change) {
+	<-b.unlock
+	var sub *subscription
+	for i, s := range b.subscriptions {
+		if s.c == c {
+			sub = s
+			b.subscriptions = append(b.subscriptions[:i:i],
+				b.subscriptions[i+1:]...)
+			break
+		}
+	}
+	b.unlock <- 1
+	if sub != nil {
+		b.Unlisten(sub.id)
+		close(sub.done)
+		<-sub.stopped
+	}
+}
@@ -0,0 +1,77 @@
+package edit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBufferListen(t *testing.T) {
+	b := NewBuffer()
+	var changes []Change
+	id := b.Listen(func(c Change) {
+		changes = append(changes, c)
+	})
+	b.Insert(b.End(), "hello\nworld")
+	b.Separate()
+	b.Delete(Index{1, 2}, Index{2, 1})
+	b.Undo()
+	b.Redo()
+	b.ReadFrom(strings.NewReader("new\ntext"))
+	want := []Change{
+		{InsertChange, Index{1, 0}, Index{2, 5}, "hello\nworld", EditOrigin},
+		{DeleteChange, Index{1, 2}, Index{2, 1}, "llo\nw", EditOrigin},
+		{InsertChange, Index{1, 2}, Index{2, 1}, "llo\nw", UndoOrigin},
+		{DeleteChange, Index{1, 2}, Index{2, 1}, "llo\nw", RedoOrigin},
+		{LoadChange, Index{1, 0}, Index{2, 4}, "", EditOrigin},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("listener got %v changes; want %v", len(changes), len(want))
+	}
+	for i := range want {
+		if want[i] != changes[i] {
+			t.Errorf("listener got %#v; want %#v", changes[i], want[i])
+		}
+	}
+
+	// unregistration
+	b.Unlisten(id)
+	b.Insert(b.End(), "!")
+	if len(changes) != len(want) {
+		t.Errorf("listener called after Unlisten")
+	}
+}
+
+func TestBufferSubscribe(t *testing.T) {
+	b := NewBuffer()
+	c := b.Subscribe()
+	for i := 0; i < 100; i++ {
+		b.Insert(b.End(), "a")
+	}
+	for i := 0; i < 100; i++ {
+		want := Change{InsertChange, Index{1, i}, Index{1, i + 1}, "a",
+			EditOrigin}
+		if got := <-c; want != got {
+			t.Fatalf("<-c == %#v; want %#v", got, want)
+		}
+	}
+	b.Unsubscribe(c)
+	b.Insert(b.End(), "a")
+	if _, ok := <-c; ok {
+		t.Error("channel should be closed")
+	}
+	b.Unsubscribe(c) // shouldn't panic
+}
+
+func TestBufferUnsubscribePending(t *testing.T) {
+	b := NewBuffer()
+	for i := 0; i < 100; i++ {
+		c := b.Subscribe()
+		b.Insert(b.End(), "a")
+		b.Insert(b.End(), "b")
+		b.Unsubscribe(c)
+		if change, ok := <-c; ok {
+			t.Fatalf("<-c == %#v after Unsubscribe; want closed channel",
+				change)
+		}
+	}
+}
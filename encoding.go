@@ -0,0 +1,242 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding converts text between runes and a byte encoding. Implementations
+// other than the ones provided by this package may be used to read and write
+// Buffer contents.
+type Encoding interface {
+	// String returns the name of the encoding.
+	String() string
+
+	// BOM returns the byte order mark that begins text in the encoding, or
+	// nil if the encoding does not use one.
+	BOM() []byte
+
+	// DecodeRune decodes the first rune in p and returns it along with its
+	// width in bytes. If p does not begin with a complete, valid encoding of
+	// a rune, the returned width is 0.
+	DecodeRune(p []byte) (r rune, size int)
+
+	// AppendRune appends the encoding of r to p and returns the extended
+	// slice, or returns false if r cannot be represented in the encoding.
+	AppendRune(p []byte, r rune) ([]byte, bool)
+}
+
+// maxEncodedLen is the maximum width in bytes of an encoded rune that
+// DecodeRune is given to examine.
+const maxEncodedLen = 4
+
+// Encodings provided by this package.
+var (
+	UTF8       Encoding = &utf8Encoding{"UTF-8", nil}
+	UTF8BOM    Encoding = &utf8Encoding{"UTF-8 with BOM", []byte{0xef, 0xbb, 0xbf}}
+	UTF16LE    Encoding = &utf16Encoding{"UTF-16LE", nil, false}
+	UTF16LEBOM Encoding = &utf16Encoding{"UTF-16LE with BOM", []byte{0xff, 0xfe}, false}
+	UTF16BE    Encoding = &utf16Encoding{"UTF-16BE", nil, true}
+	UTF16BEBOM Encoding = &utf16Encoding{"UTF-16BE with BOM", []byte{0xfe, 0xff}, true}
+	Latin1     Encoding = &latin1Encoding{}
+)
+
+type utf8Encoding struct {
+	name string
+	bom  []byte
+}
+
+func (e *utf8Encoding) String() string { return e.name }
+func (e *utf8Encoding) BOM() []byte    { return e.bom }
+
+func (e *utf8Encoding) DecodeRune(p []byte) (rune, int) {
+	r, size := utf8.DecodeRune(p)
+	if r == utf8.RuneError && size < 2 {
+		return r, 0
+	}
+	return r, size
+}
+
+func (e *utf8Encoding) AppendRune(p []byte, r rune) ([]byte, bool) {
+	if !utf8.ValidRune(r) {
+		return p, false
+	}
+	var buf [utf8.UTFMax]byte
+	return append(p, buf[:utf8.EncodeRune(buf[:], r)]...), true
+}
+
+type utf16Encoding struct {
+	name      string
+	bom       []byte
+	bigEndian bool
+}
+
+func (e *utf16Encoding) String() string { return e.name }
+func (e *utf16Encoding) BOM() []byte    { return e.bom }
+
+func (e *utf16Encoding) unit(p []byte) rune {
+	if e.bigEndian {
+		return rune(p[0])<<8 | rune(p[1])
+	}
+	return rune(p[1])<<8 | rune(p[0])
+}
+
+func (e *utf16Encoding) DecodeRune(p []byte) (rune, int) {
+	if len(p) < 2 {
+		return utf8.RuneError, 0
+	}
+	r1 := e.unit(p)
+	if !utf16.IsSurrogate(r1) {
+		return r1, 2
+	}
+	if len(p) < 4 {
+		return utf8.RuneError, 0
+	}
+	if r := utf16.DecodeRune(r1, e.unit(p[2:])); r != utf8.RuneError {
+		return r, 4
+	}
+	return utf8.RuneError, 0
+}
+
+func (e *utf16Encoding) AppendRune(p []byte, r rune) ([]byte, bool) {
+	units := []rune{r}
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		units = []rune{r1, r2}
+	} else if r > 0xffff || utf16.IsSurrogate(r) {
+		return p, false
+	}
+	for _, u := range units {
+		if e.bigEndian {
+			p = append(p, byte(u>>8), byte(u))
+		} else {
+			p = append(p, byte(u), byte(u>>8))
+		}
+	}
+	return p, true
+}
+
+type latin1Encoding struct{}
+
+func (e *latin1Encoding) String() string { return "ISO-8859-1" }
+func (e *latin1Encoding) BOM() []byte    { return nil }
+
+func (e *latin1Encoding) DecodeRune(p []byte) (rune, int) {
+	if len(p) == 0 {
+		return utf8.RuneError, 0
+	}
+	return rune(p[0]), 1
+}
+
+func (e *latin1Encoding) AppendRune(p []byte, r rune) ([]byte, bool) {
+	if r < 0 || r > 0xff {
+		return p, false
+	}
+	return append(p, byte(r)), true
+}
+
+// DetectEncoding guesses the encoding of text beginning with p. A byte order
+// mark identifies the encoding if present. Otherwise, text with many zero
+// bytes in alternating positions is taken to be UTF-16, valid UTF-8 is taken
+// to be UTF-8, and anything else is taken to be Latin-1.
+func DetectEncoding(p []byte) Encoding {
+	for _, enc := range []Encoding{UTF8BOM, UTF16LEBOM, UTF16BEBOM} {
+		if bytes.HasPrefix(p, enc.BOM()) {
+			return enc
+		}
+	}
+
+	// Count zero bytes at even and odd offsets
+	var zeros [2]int
+	for i, c := range p {
+		if c == 0 {
+			zeros[i%2]++
+		}
+	}
+	if n := len(p) / 2; n > 0 {
+		if zeros[1] > n/4 && zeros[0] == 0 {
+			return UTF16LE
+		} else if zeros[0] > n/4 && zeros[1] == 0 {
+			return UTF16BE
+		}
+	}
+
+	// Ignore a rune cut off by the end of the sample
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if !utf8.FullRune(p[len(p)-i:]) {
+				p = p[:len(p)-i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(p) {
+		return UTF8
+	}
+	return Latin1
+}
+
+// DecodeError describes input that could not be decoded.
+type DecodeError struct {
+	Offset   int64 // offset in bytes of the undecodable input
+	Encoding Encoding
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("edit: invalid %v input at byte offset %d",
+		e.Encoding, e.Offset)
+}
+
+// EncodeError describes a rune that could not be encoded.
+type EncodeError struct {
+	Index    Index // position of the rune in the buffer
+	Rune     rune
+	Encoding Encoding
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("edit: %U at %d.%d cannot be encoded in %v", e.Rune,
+		e.Index.Line, e.Index.Char, e.Encoding)
+}
+
+// decoder reads runes in an Encoding from a bufio.Reader.
+type decoder struct {
+	r      *bufio.Reader
+	enc    Encoding
+	offset int64 // offset in bytes of the next rune
+	last   rune  // last rune read
+	size   int   // size of last rune read
+	unread bool  // true if last rune should be read again
+}
+
+// ReadRune returns the next rune and its size in bytes, or a *DecodeError if
+// the input cannot be decoded.
+func (d *decoder) ReadRune() (r rune, size int, err error) {
+	if d.unread {
+		d.unread = false
+		return d.last, d.size, nil
+	}
+	p, err := d.r.Peek(maxEncodedLen)
+	if len(p) == 0 {
+		return 0, 0, err
+	}
+	if r, size = d.enc.DecodeRune(p); size == 0 {
+		if err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+		return 0, 0, &DecodeError{d.offset, d.enc}
+	}
+	d.r.Discard(size)
+	d.offset += int64(size)
+	d.last, d.size = r, size
+	return r, size, nil
+}
+
+// UnreadRune causes the next call to ReadRune to return the last rune read.
+func (d *decoder) UnreadRune() error {
+	d.unread = true
+	return nil
+}
@@ -0,0 +1,103 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestEncodings(t *testing.T) {
+	text := "aé€😀"
+	encoded := map[Encoding][]byte{
+		UTF8: []byte(text),
+		UTF16LE: {'a', 0, 0xe9, 0, 0xac, 0x20, 0x3d, 0xd8, 0x00,
+			0xde},
+		UTF16BE: {0, 'a', 0, 0xe9, 0x20, 0xac, 0xd8, 0x3d, 0xde,
+			0x00},
+	}
+	for enc, want := range encoded {
+		// encode
+		var got []byte
+		for _, ch := range text {
+			var ok bool
+			if got, ok = enc.AppendRune(got, ch); !ok {
+				t.Errorf("%v.AppendRune(%U) failed", enc, ch)
+			}
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("%v encoded %#v; want %#v", enc, got, want)
+		}
+
+		// decode
+		var runes []rune
+		for p := want; len(p) > 0; {
+			ch, size := enc.DecodeRune(p)
+			if size == 0 {
+				t.Errorf("%v.DecodeRune(%#v) failed", enc, p)
+				break
+			}
+			runes = append(runes, ch)
+			p = p[size:]
+		}
+		if string(runes) != text {
+			t.Errorf("%v decoded %#v; want %#v", enc, string(runes), text)
+		}
+	}
+
+	// invalid input
+	if _, size := UTF8.DecodeRune([]byte{0xff}); size != 0 {
+		t.Errorf("UTF8.DecodeRune(0xff) returned size %v; want 0", size)
+	}
+	if _, size := UTF16LE.DecodeRune([]byte{0x3d, 0xd8, 'a', 0}); size != 0 {
+		t.Errorf("UTF16LE.DecodeRune() returned size %v; want 0", size)
+	}
+
+	// Latin-1
+	if ch, _ := Latin1.DecodeRune([]byte{0xe9}); ch != 'é' {
+		t.Errorf("Latin1.DecodeRune(0xe9) == %U; want %U", ch, 'é')
+	}
+	if _, ok := Latin1.AppendRune(nil, '€'); ok {
+		t.Error("Latin1.AppendRune('€') succeeded")
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		p   []byte
+		enc Encoding
+	}{
+		{[]byte(""), UTF8},
+		{[]byte("hello"), UTF8},
+		{[]byte("\xef\xbb\xbfhello"), UTF8BOM},
+		{[]byte("\xff\xfeh\x00i\x00"), UTF16LEBOM},
+		{[]byte("\xfe\xff\x00h\x00i"), UTF16BEBOM},
+		{[]byte("h\x00e\x00l\x00l\x00o\x00"), UTF16LE},
+		{[]byte("\x00h\x00e\x00l\x00l\x00o"), UTF16BE},
+		{[]byte("caf\xc3\xa9"), UTF8},
+		{[]byte("caf\xc3"), UTF8}, // rune cut off by end of sample
+		{[]byte("caf\xe9!"), Latin1},
+	}
+	for _, test := range tests {
+		if got := DetectEncoding(test.p); got != test.enc {
+			t.Errorf("DetectEncoding(%#v) == %v; want %v", test.p, got,
+				test.enc)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	d := &decoder{r: bufio.NewReader(bytes.NewReader([]byte("a\xffb"))),
+		enc: UTF8}
+	if ch, size, err := d.ReadRune(); ch != 'a' || size != 1 || err != nil {
+		t.Errorf("ReadRune() == %v, %v, %v; want %v, %v, %v", ch, size, err,
+			'a', 1, nil)
+	}
+	d.UnreadRune()
+	if ch, _, _ := d.ReadRune(); ch != 'a' {
+		t.Errorf("ReadRune() == %v; want %v", ch, 'a')
+	}
+	_, _, err := d.ReadRune()
+	if e, ok := err.(*DecodeError); !ok || e.Offset != 1 {
+		t.Errorf("ReadRune() returned error %#v; want offset 1", err)
+	}
+}
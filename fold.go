@@ -0,0 +1,254 @@
+package edit
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+)
+
+// FoldTag is the tag of the placeholder fragment displayed at the end of the
+// first line of a fold, in place of the hidden lines.
+const FoldTag = -3
+
+// fold is a range of lines whose lines after the first are hidden.
+type fold struct {
+	begin, end int
+}
+
+// Fold hides the lines after begin up to and including end from display, and
+// returns an ID for the fold, or 0 if there are no such lines. A placeholder
+// fragment tagged with FoldTag is displayed at the end of line begin. Like a
+// mark, the fold's lines are automatically updated when the buffer contents
+// are modified; a fold is removed when all of its hidden lines are deleted.
+// Folds may be nested.
+func (b *Buffer) Fold(begin, end int) int {
+	<-b.unlock
+	id := b.fold(begin, end)
+	b.unlock <- 1
+	return id
+}
+
+func (b *Buffer) fold(begin, end int) int {
+	begin, end = b.clip(Index{begin, 0}).Line, b.clip(Index{end, 0}).Line
+	if end <= begin {
+		return 0
+	}
+	b.nextFold++
+	b.folds[b.nextFold] = fold{begin, end}
+	b.foldSpans = nil
+	b.refold(begin, end)
+	return b.nextFold
+}
+
+// Unfold removes the fold with ID id, if it exists, showing its lines.
+func (b *Buffer) Unfold(id int) {
+	<-b.unlock
+	if f, ok := b.folds[id]; ok {
+		delete(b.folds, id)
+		b.foldSpans = nil
+		b.refold(f.begin, f.end)
+	}
+	b.unlock <- 1
+}
+
+// FoldRange returns the first and last lines of the fold with ID id, or 0, 0
+// if no fold with ID id exists.
+func (b *Buffer) FoldRange(id int) (begin, end int) {
+	<-b.unlock
+	f := b.folds[id]
+	b.unlock <- 1
+	return f.begin, f.end
+}
+
+// FoldIndentation folds the lines following line that are indented more than
+// it, along with blank lines between them, as by Fold. Indentation is
+// measured using the tab width of the buffer's display.
+func (b *Buffer) FoldIndentation(line int) int {
+	<-b.unlock
+	line = b.clip(Index{line, 0}).Line
+	indent, _ := b.indentation(line)
+	end := line
+	for i := line + 1; i <= b.lines.Len(); i++ {
+		n, blank := b.indentation(i)
+		if blank {
+			continue
+		} else if n <= indent {
+			break
+		}
+		end = i
+	}
+	id := b.fold(line, end)
+	b.unlock <- 1
+	return id
+}
+
+// indentation returns the width of the leading white space of line, and
+// whether the line is blank.
+func (b *Buffer) indentation(line int) (int, bool) {
+	n := 0
+	for _, c := range b.lines.Line(line) {
+		switch {
+		case c == '\t':
+			n += b.view.tabWidth - n%b.view.tabWidth
+		case unicode.IsSpace(c):
+			n++
+		default:
+			return n, false
+		}
+	}
+	return n, true
+}
+
+// FoldRegion folds the region of a region rule in the buffer's syntax that
+// begins on line and ends on a later line, or at the end of the buffer, as
+// by Fold. The line that ends the region is hidden as well. If no region
+// begins on line, 0 is returned.
+func (b *Buffer) FoldRegion(line int) int {
+	<-b.unlock
+	line = b.clip(Index{line, 0}).Line
+	v := b.view
+	v.highlight(line)
+	display := v.dLines.Get(line).Value.(lineDisplay)
+	id := 0
+	if state := display.end; state != noneState && display.begin != state {
+		end := b.lines.Len()
+		for i := line + 1; i <= b.lines.Len(); i++ {
+			v.highlight(i)
+			if v.dLines.Get(i).Value.(lineDisplay).end != state {
+				end = i
+				break
+			}
+		}
+		id = b.fold(line, end)
+	}
+	b.unlock <- 1
+	return id
+}
+
+// hidden reports whether line is hidden by a fold.
+func (b *Buffer) hidden(line int) bool {
+	if b.foldSpans == nil {
+		b.foldSpans = make([]fold, 0, len(b.folds))
+		for _, f := range b.folds {
+			b.foldSpans = append(b.foldSpans, f)
+		}
+		sort.Slice(b.foldSpans, func(i, j int) bool {
+			return b.foldSpans[i].begin < b.foldSpans[j].begin
+		})
+		for i := 1; i < len(b.foldSpans); i++ {
+			if end := b.foldSpans[i-1].end; end > b.foldSpans[i].end {
+				b.foldSpans[i].end = end
+			}
+		}
+	}
+	// the last fold beginning before line decides, since its end is the
+	// greatest of the folds up to it
+	k := sort.Search(len(b.foldSpans), func(i int) bool {
+		return b.foldSpans[i].begin >= line
+	})
+	return k > 0 && b.foldSpans[k-1].end >= line
+}
+
+// placeholder returns the text displayed in place of the lines hidden by
+// the outermost fold beginning on line, or the empty string if there is no
+// such fold.
+func (b *Buffer) placeholder(line int) string {
+	end := line
+	for _, f := range b.folds {
+		if f.begin == line && f.end > end {
+			end = f.end
+		}
+	}
+	switch end - line {
+	case 0:
+		return ""
+	case 1:
+		return " ⋯ 1 line"
+	}
+	return fmt.Sprintf(" ⋯ %d lines", end-line)
+}
+
+// refold updates the display of lines from begin to end in each view after
+// folds change.
+func (b *Buffer) refold(begin, end int) {
+	for _, v := range b.views {
+		v.dLines.Walk(begin, func(i int, n *node) bool {
+			v.set(i, n.Value.(lineDisplay))
+			return i < end
+		})
+	}
+}
+
+// moveFolds updates the lines of folds after n lines are inserted after
+// line, or -n lines are deleted after line if n is negative.
+func (b *Buffer) moveFolds(line, n int) {
+	b.foldSpans = nil
+	for id, f := range b.folds {
+		if f.begin > line {
+			if f.begin += n; f.begin < line {
+				f.begin = line
+			}
+		}
+		if f.end > line {
+			if f.end += n; f.end < line {
+				f.end = line
+			}
+		}
+		if f.end <= f.begin {
+			delete(b.folds, id)
+		} else {
+			b.folds[id] = f
+		}
+	}
+}
+
+// visible returns index, or the end of the first line of the outermost fold
+// that hides index.
+func (b *Buffer) visible(index Index) Index {
+	line := index.Line
+	for _, f := range b.folds {
+		if index.Line > f.begin && index.Line <= f.end && f.begin < line {
+			line = f.begin
+		}
+	}
+	if line != index.Line {
+		index = Index{line, b.lines.LineLen(line)}
+	}
+	return index
+}
+
+// set sets the display of line i, with a weight of 0 if the line is hidden.
+// A line that hasn't been laid out has a weight of 1.
+func (v *View) set(i int, display lineDisplay) {
+	weight := len(display.rows)
+	if display.rows == nil {
+		weight = 1
+	}
+	if len(v.b.folds) > 0 && v.b.hidden(i) {
+		weight = 0
+	}
+	v.dLines.Set(i, display, weight)
+}
+
+// withPlaceholder returns the rows of line i, with the placeholder of a fold
+// beginning on the line appended. When wrapping, the placeholder is truncated
+// to the space left on the last row.
+func (v *View) withPlaceholder(i int, rows []fragList) []fragList {
+	if len(v.b.folds) == 0 {
+		return rows
+	}
+	if text := v.b.placeholder(i); text != "" {
+		rows = append([]fragList(nil), rows...)
+		last := append(fragList(nil), rows[len(rows)-1]...)
+		placeholder := fragList{{text, FoldTag}}
+		if v.wrap.Mode != NoWrap {
+			width := 0
+			for _, frag := range last {
+				width += stringWidth(frag.Text)
+			}
+			placeholder = clipRow(placeholder, 0, v.cols-width)
+		}
+		rows[len(rows)-1] = append(last, placeholder...)
+	}
+	return rows
+}
@@ -0,0 +1,126 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBufferFold(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(12, 4)
+	b.Insert(b.End(), "a\nb\nc\nd\ne\nf")
+	id := b.Fold(2, 4)
+	if begin, end := b.FoldRange(id); begin != 2 || end != 4 {
+		t.Errorf("FoldRange() == %v, %v; want 2, 4", begin, end)
+	}
+	want := [][]Fragment{{{"a", noneTag}},
+		{{"b", noneTag}, {" ⋯ 2 lines", FoldTag}}, {{"e", noneTag}},
+		{{"f", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// coordinates skip hidden lines
+	if col, row := b.CoordsFromIndex(Index{5, 0}); col != 0 || row != 2 {
+		t.Errorf("CoordsFromIndex() == %v, %v; want 0, 2", col, row)
+	}
+	if col, row := b.CoordsFromIndex(Index{3, 0}); col != 1 || row != 1 {
+		t.Errorf("CoordsFromIndex() == %v, %v; want 1, 1", col, row)
+	}
+	if want, got := (Index{5, 0}), b.IndexFromCoords(0, 2); want != got {
+		t.Errorf("IndexFromCoords() == %v; want %v", got, want)
+	}
+	if want, got := (Index{2, 1}), b.IndexFromCoords(5, 1); want != got {
+		t.Errorf("IndexFromCoords() == %v; want %v", got, want)
+	}
+	if want, got := -1.0, b.ScrollFraction(); want != got {
+		t.Errorf("ScrollFraction() == %v; want %v", got, want)
+	}
+
+	// folds follow edits
+	b.Insert(Index{1, 0}, "0\n")
+	if begin, end := b.FoldRange(id); begin != 3 || end != 5 {
+		t.Errorf("FoldRange() == %v, %v; want 3, 5", begin, end)
+	}
+	b.Insert(Index{4, 0}, "x\n")
+	if begin, end := b.FoldRange(id); begin != 3 || end != 6 {
+		t.Errorf("FoldRange() == %v, %v; want 3, 6", begin, end)
+	}
+	want = [][]Fragment{{{"0", noneTag}}, {{"a", noneTag}},
+		{{"b", noneTag}, {" ⋯ 3 lines", FoldTag}}, {{"e", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	b.Delete(Index{3, 1}, Index{6, 1})
+	if begin, end := b.FoldRange(id); begin != 0 || end != 0 {
+		t.Errorf("FoldRange() == %v, %v; want 0, 0", begin, end)
+	}
+
+	// nested folds
+	b.ReadFrom(strings.NewReader("a\nb\nc\nd\ne"))
+	inner, outer := b.Fold(3, 4), b.Fold(2, 4)
+	want = [][]Fragment{{{"a", noneTag}},
+		{{"b", noneTag}, {" ⋯ 2 lines", FoldTag}}, {{"e", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	b.Unfold(outer)
+	want = [][]Fragment{{{"a", noneTag}}, {{"b", noneTag}},
+		{{"c", noneTag}, {" ⋯ 1 line", FoldTag}}, {{"e", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	b.Unfold(inner)
+	if want, got := (Index{4, 0}), b.IndexFromCoords(0, 3); want != got {
+		t.Errorf("IndexFromCoords() == %v; want %v", got, want)
+	}
+	if id := b.Fold(5, 5); id != 0 {
+		t.Errorf("Fold(5, 5) == %v; want 0", id)
+	}
+
+	// placeholders are truncated to fit the display
+	b.SetSize(5, 4)
+	b.ReadFrom(strings.NewReader("abcde\nx\nab\nc\nd"))
+	b.Fold(1, 2)
+	b.Fold(3, 5)
+	want = [][]Fragment{{{"abcde", noneTag}}, {{"ab", noneTag},
+		{" ⋯ ", FoldTag}}, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+}
+
+func TestBufferFoldIndentation(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "func f() {\n\tif x {\n\t\ty()\n\n\t}\n}\n")
+	id := b.FoldIndentation(1)
+	if begin, end := b.FoldRange(id); begin != 1 || end != 5 {
+		t.Errorf("FoldRange() == %v, %v; want 1, 5", begin, end)
+	}
+	id = b.FoldIndentation(2)
+	if begin, end := b.FoldRange(id); begin != 2 || end != 3 {
+		t.Errorf("FoldRange() == %v, %v; want 2, 3", begin, end)
+	}
+	if id := b.FoldIndentation(3); id != 0 {
+		t.Errorf("FoldIndentation(3) == %v; want 0", id)
+	}
+}
+
+func TestBufferFoldRegion(t *testing.T) {
+	b := NewBuffer()
+	rule, _ := NewRegionRule(`/\*`, `\*/`, 1)
+	b.SetSyntax([]Rule{rule})
+	b.Insert(b.End(), "a /* b\nc\nd */ e\n/* f */\n/*\ng")
+	id := b.FoldRegion(1)
+	if begin, end := b.FoldRange(id); begin != 1 || end != 3 {
+		t.Errorf("FoldRange() == %v, %v; want 1, 3", begin, end)
+	}
+	if id := b.FoldRegion(4); id != 0 {
+		t.Errorf("FoldRegion(4) == %v; want 0", id)
+	}
+	id = b.FoldRegion(5)
+	if begin, end := b.FoldRange(id); begin != 5 || end != 6 {
+		t.Errorf("FoldRange() == %v, %v; want 5, 6", begin, end)
+	}
+}
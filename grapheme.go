@@ -0,0 +1,240 @@
+package edit
+
+import (
+	"sort"
+	"unicode"
+)
+
+// runeRange is an inclusive range of runes.
+type runeRange [2]rune
+
+// inRanges reports whether r is in one of ranges, which must be sorted.
+func inRanges(r rune, ranges []runeRange) bool {
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i][1] >= r
+	})
+	return i < len(ranges) && ranges[i][0] <= r
+}
+
+// wideRanges holds the runes with East Asian Width W or F.
+var wideRanges = []runeRange{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6},
+	{0x16fe0, 0x16fe4}, {0x17000, 0x18aff}, {0x1b000, 0x1b2ff},
+	{0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a}, {0x1f200, 0x1f202}, {0x1f210, 0x1f23b},
+	{0x1f240, 0x1f248}, {0x1f250, 0x1f251}, {0x1f260, 0x1f265},
+	{0x1f300, 0x1f320}, {0x1f32d, 0x1f335}, {0x1f337, 0x1f37c},
+	{0x1f37e, 0x1f393}, {0x1f3a0, 0x1f3ca}, {0x1f3cf, 0x1f3d3},
+	{0x1f3e0, 0x1f3f0}, {0x1f3f4, 0x1f3f4}, {0x1f3f8, 0x1f43e},
+	{0x1f440, 0x1f440}, {0x1f442, 0x1f4fc}, {0x1f4ff, 0x1f53d},
+	{0x1f54b, 0x1f54e}, {0x1f550, 0x1f567}, {0x1f57a, 0x1f57a},
+	{0x1f595, 0x1f596}, {0x1f5a4, 0x1f5a4}, {0x1f5fb, 0x1f64f},
+	{0x1f680, 0x1f6c5}, {0x1f6cc, 0x1f6cc}, {0x1f6d0, 0x1f6d2},
+	{0x1f6d5, 0x1f6d7}, {0x1f6eb, 0x1f6ec}, {0x1f6f4, 0x1f6fc},
+	{0x1f7e0, 0x1f7eb}, {0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945},
+	{0x1f947, 0x1f9ff}, {0x1fa70, 0x1faff}, {0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
+
+// pictographicRanges approximates the runes with the Extended_Pictographic
+// property.
+var pictographicRanges = []runeRange{
+	{0x00a9, 0x00a9}, {0x00ae, 0x00ae}, {0x203c, 0x203c}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21a9, 0x21aa},
+	{0x231a, 0x231b}, {0x2328, 0x2328}, {0x2388, 0x2388}, {0x23cf, 0x23cf},
+	{0x23e9, 0x23f3}, {0x23f8, 0x23fa}, {0x24c2, 0x24c2}, {0x25aa, 0x25ab},
+	{0x25b6, 0x25b6}, {0x25c0, 0x25c0}, {0x25fb, 0x25fe}, {0x2600, 0x27bf},
+	{0x2934, 0x2935}, {0x2b05, 0x2b07}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50},
+	{0x2b55, 0x2b55}, {0x3030, 0x3030}, {0x303d, 0x303d}, {0x3297, 0x3297},
+	{0x3299, 0x3299}, {0x1f000, 0x1f0ff}, {0x1f10d, 0x1f10f},
+	{0x1f12f, 0x1f12f}, {0x1f16c, 0x1f171}, {0x1f17e, 0x1f17f},
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f1ad, 0x1f1e5},
+	{0x1f201, 0x1f20f}, {0x1f21a, 0x1f21a}, {0x1f22f, 0x1f22f},
+	{0x1f232, 0x1f23a}, {0x1f23c, 0x1f23f}, {0x1f249, 0x1f3fa},
+	{0x1f400, 0x1f53d}, {0x1f546, 0x1f64f}, {0x1f680, 0x1f6ff},
+	{0x1f774, 0x1f77f}, {0x1f7d5, 0x1f7ff}, {0x1f80c, 0x1f80f},
+	{0x1f848, 0x1f84f}, {0x1f85a, 0x1f85f}, {0x1f888, 0x1f88f},
+	{0x1f8ae, 0x1f8ff}, {0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945},
+	{0x1f947, 0x1faff}, {0x1fc00, 0x1fffd},
+}
+
+// runeWidth returns the number of columns occupied by r: 2 for wide
+// characters, 0 for combining marks and other characters that are drawn
+// as part of a preceding character, and 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x300:
+		return 1
+	case r == 0x200b || r == 0x200c || r == 0x200d,
+		r >= 0x1160 && r <= 0x11ff, // Hangul medial vowels and final consonants
+		unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case inRanges(r, wideRanges):
+		return 2
+	}
+	return 1
+}
+
+// gbProperty is a Grapheme_Cluster_Break property value.
+type gbProperty int
+
+// Grapheme_Cluster_Break property values.
+const (
+	gbOther gbProperty = iota
+	gbCR
+	gbLF
+	gbControl
+	gbExtend
+	gbZWJ
+	gbRegionalIndicator
+	gbPrepend
+	gbSpacingMark
+	gbL
+	gbV
+	gbT
+	gbLV
+	gbLVT
+)
+
+// graphemeProperty returns the Grapheme_Cluster_Break property of r.
+func graphemeProperty(r rune) gbProperty {
+	switch {
+	case r < 0x7f:
+		switch {
+		case r == '\r':
+			return gbCR
+		case r == '\n':
+			return gbLF
+		case r < 0x20:
+			return gbControl
+		}
+		return gbOther
+	case r == 0x200c, r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f:
+		return gbExtend
+	case r == 0x200d:
+		return gbZWJ
+	case r >= 0x1f1e6 && r <= 0x1f1ff:
+		return gbRegionalIndicator
+	case r >= 0x600 && r <= 0x605, r == 0x6dd, r == 0x70f, r == 0x8e2,
+		r == 0x110bd:
+		return gbPrepend
+	case r >= 0x1100 && r <= 0x115f, r >= 0xa960 && r <= 0xa97c:
+		return gbL
+	case r >= 0x1160 && r <= 0x11a7, r >= 0xd7b0 && r <= 0xd7c6:
+		return gbV
+	case r >= 0x11a8 && r <= 0x11ff, r >= 0xd7cb && r <= 0xd7fb:
+		return gbT
+	case r >= 0xac00 && r <= 0xd7a3:
+		if (r-0xac00)%28 == 0 {
+			return gbLV
+		}
+		return gbLVT
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return gbExtend
+	case unicode.Is(unicode.Mc, r):
+		return gbSpacingMark
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gbControl
+	}
+	return gbOther
+}
+
+// clusterLen returns the length in runes of the extended grapheme cluster
+// at the beginning of s, as defined by Unicode Standard Annex #29, or 0 if s
+// is empty.
+func clusterLen(s []rune) int {
+	if len(s) == 0 {
+		return 0
+	}
+	prev := graphemeProperty(s[0])
+	pictographic := inRanges(s[0], pictographicRanges) // GB11 sequence
+	regional := prev == gbRegionalIndicator            // odd count for GB12
+	i := 1
+	for ; i < len(s); i++ {
+		next := graphemeProperty(s[i])
+		switch {
+		case prev == gbCR && next == gbLF: // GB3
+		case prev == gbCR || prev == gbLF || prev == gbControl: // GB4
+			return i
+		case next == gbCR || next == gbLF || next == gbControl: // GB5
+			return i
+		case prev == gbL && (next == gbL || next == gbV || next == gbLV ||
+			next == gbLVT): // GB6
+		case (prev == gbLV || prev == gbV) && (next == gbV || next == gbT):
+			// GB7
+		case (prev == gbLVT || prev == gbT) && next == gbT: // GB8
+		case next == gbExtend || next == gbZWJ: // GB9
+		case next == gbSpacingMark: // GB9a
+		case prev == gbPrepend: // GB9b
+		case prev == gbZWJ && pictographic &&
+			inRanges(s[i], pictographicRanges): // GB11
+		case prev == gbRegionalIndicator && next == gbRegionalIndicator &&
+			regional: // GB12, GB13
+			regional = false
+		default: // GB999
+			return i
+		}
+		if next != gbExtend && next != gbZWJ {
+			pictographic = inRanges(s[i], pictographicRanges)
+		}
+		prev = next
+	}
+	return i
+}
+
+// clusterWidth returns the number of columns occupied by the grapheme
+// cluster c. Every cluster occupies at least one column, so that each
+// position in a line has distinct display coordinates.
+func clusterWidth(c []rune) int {
+	w := runeWidth(c[0])
+	if len(c) > 1 && w == 1 {
+		// Emoji presentation selector and flag sequences
+		if graphemeProperty(c[0]) == gbRegionalIndicator {
+			w = 2
+		}
+		for _, r := range c[1:] {
+			if r == 0xfe0f {
+				w = 2
+			}
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// stringWidth returns the number of columns occupied by s.
+func stringWidth(s string) int {
+	text, w := []rune(s), 0
+	for len(text) > 0 {
+		n := clusterLen(text)
+		w += clusterWidth(text[:n])
+		text = text[n:]
+	}
+	return w
+}
+
+// clusterAt returns the beginning and end of the grapheme cluster of s that
+// contains the rune at index i. If i is len(s), both are len(s).
+func clusterAt(s []rune, i int) (begin, end int) {
+	for end < len(s) {
+		n := clusterLen(s[end:])
+		if end+n > i {
+			return end, end + n
+		}
+		end += n
+	}
+	return end, end
+}
@@ -0,0 +1,70 @@
+package edit
+
+import "testing"
+
+func TestRuneWidth(t *testing.T) {
+	for _, c := range []struct {
+		r    rune
+		want int
+	}{
+		{'a', 1}, {'é', 1}, {'\u0301', 0}, {'\u200d', 0}, {'日', 2},
+		{'ｱ', 1}, {'Ａ', 2}, {'한', 2}, {'\U0001f600', 2}, {'❤', 1},
+	} {
+		if got := runeWidth(c.r); c.want != got {
+			t.Errorf("runeWidth(%U) returned %v; want %v", c.r, got, c.want)
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		want  []string
+		width []int
+	}{
+		{"", nil, nil},
+		{"abc", []string{"a", "b", "c"}, []int{1, 1, 1}},
+		{"e\u0301x", []string{"e\u0301", "x"}, []int{1, 1}},
+		{"\r\n\n", []string{"\r\n", "\n"}, []int{1, 1}},
+		{"\u0301", []string{"\u0301"}, []int{1}},
+		{"각가", []string{"각", "가"},
+			[]int{2, 2}},
+		{"🇯🇵🇺🇸🇫", []string{"🇯🇵", "🇺🇸", "🇫"}, []int{2, 2, 1}},
+		{"👩‍💻👍🏽", []string{"👩‍💻", "👍🏽"}, []int{2, 2}},
+		{"❤️", []string{"❤️"}, []int{2}},
+		{"a‍b", []string{"a‍", "b"}, []int{1, 1}},
+		{"؀a", []string{"؀a"}, []int{1}},
+		{"क्ष", []string{"क्", "ष"}, []int{1, 1}},
+	} {
+		s := []rune(c.s)
+		var got []string
+		var width []int
+		for len(s) > 0 {
+			n := clusterLen(s)
+			got = append(got, string(s[:n]))
+			width = append(width, clusterWidth(s[:n]))
+			s = s[n:]
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("clusters of %+q == %+q; want %+q", c.s, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] || width[i] != c.width[i] {
+				t.Errorf("clusters of %+q == %+q, widths %v; want %+q, %v",
+					c.s, got, width, c.want, c.width)
+				break
+			}
+		}
+	}
+}
+
+func TestClusterAt(t *testing.T) {
+	s := []rune("ae\u0301b")
+	for i, want := range [][2]int{{0, 1}, {1, 3}, {1, 3}, {3, 4}, {4, 4}} {
+		if begin, end := clusterAt(s, i); want != [2]int{begin, end} {
+			t.Errorf("clusterAt(%+q, %v) == %v, %v; want %v", string(s), i,
+				begin, end, want)
+		}
+	}
+}
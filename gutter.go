@@ -0,0 +1,99 @@
+package edit
+
+import "sort"
+
+// Sign is a marker displayed in the gutter beside a line, such as a
+// breakpoint, a diagnostic, or a diff marker.
+type Sign struct {
+	Group    string // kind of sign, e.g. "breakpoint"; used by RemoveSigns
+	Text     string // text displayed in the gutter, e.g. "●"
+	Priority int    // signs with higher priority are listed first
+}
+
+// placedSign is a Sign on a line.
+type placedSign struct {
+	line int
+	sign Sign
+}
+
+// AddSign adds sign to the gutter beside line and returns an ID for it. Like
+// a mark, the sign's line is automatically updated when the buffer contents
+// are modified; a sign on a deleted line moves to the line that remains.
+func (b *Buffer) AddSign(line int, sign Sign) int {
+	<-b.unlock
+	b.nextSign++
+	b.signs[b.nextSign] = placedSign{b.clip(Index{line, 0}).Line, sign}
+	id := b.nextSign
+	b.unlock <- 1
+	return id
+}
+
+// RemoveSign removes the sign with ID id, if it exists.
+func (b *Buffer) RemoveSign(id int) {
+	<-b.unlock
+	delete(b.signs, id)
+	b.unlock <- 1
+}
+
+// RemoveSigns removes the signs in group.
+func (b *Buffer) RemoveSigns(group string) {
+	<-b.unlock
+	for id, s := range b.signs {
+		if s.sign.Group == group {
+			delete(b.signs, id)
+		}
+	}
+	b.unlock <- 1
+}
+
+// SignLine returns the current line of the sign with ID id, or 0 if no sign
+// with ID id exists.
+func (b *Buffer) SignLine(id int) int {
+	<-b.unlock
+	line := b.signs[id].line
+	b.unlock <- 1
+	return line
+}
+
+// Signs returns the signs beside line, in order of decreasing priority.
+func (b *Buffer) Signs(line int) []Sign {
+	<-b.unlock
+	signs := b.signsBetween(line, line)[line]
+	b.unlock <- 1
+	return signs
+}
+
+// signsBetween returns the signs beside the lines from begin to end, keyed
+// by line and in order of decreasing priority. Signs with equal priority are
+// in the order they were added.
+func (b *Buffer) signsBetween(begin, end int) map[int][]Sign {
+	var ids []int
+	for id, s := range b.signs {
+		if s.line >= begin && s.line <= end {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		p, q := b.signs[ids[i]].sign.Priority, b.signs[ids[j]].sign.Priority
+		return p > q || p == q && ids[i] < ids[j]
+	})
+	signs := make(map[int][]Sign)
+	for _, id := range ids {
+		s := b.signs[id]
+		signs[s.line] = append(signs[s.line], s.sign)
+	}
+	return signs
+}
+
+// moveSigns updates the lines of signs after n lines are inserted after line,
+// or -n lines are deleted after line if n is negative.
+func (b *Buffer) moveSigns(line, n int) {
+	for id, s := range b.signs {
+		if s.line > line {
+			if s.line += n; s.line < line {
+				s.line = line
+			}
+			b.signs[id] = s
+		}
+	}
+}
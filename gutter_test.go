@@ -0,0 +1,80 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBufferSigns(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "1\n2\n3\n4\n5")
+	breakpoint := Sign{"breakpoint", "●", 1}
+	err := Sign{"diagnostic", "E", 2}
+	warning := Sign{"diagnostic", "W", 1}
+	id := b.AddSign(3, breakpoint)
+	b.AddSign(3, warning)
+	b.AddSign(3, err)
+	last := b.AddSign(10, warning)
+
+	want := []Sign{err, breakpoint, warning}
+	if got := b.Signs(3); !reflect.DeepEqual(want, got) {
+		t.Errorf("Signs(3) == %v; want %v", got, want)
+	}
+	if want, got := 5, b.SignLine(last); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+
+	// signs follow their lines
+	b.Insert(Index{1, 0}, "0\n")
+	if want, got := 4, b.SignLine(id); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+	b.Delete(Index{2, 1}, Index{5, 0})
+	if want, got := 2, b.SignLine(id); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+	if want, got := 3, b.SignLine(last); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+	b.ReadFrom(strings.NewReader("x"))
+	if want, got := 1, b.SignLine(last); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+
+	b.RemoveSigns("diagnostic")
+	want = []Sign{breakpoint}
+	if got := b.Signs(1); !reflect.DeepEqual(want, got) {
+		t.Errorf("Signs(1) == %v; want %v", got, want)
+	}
+	b.RemoveSign(id)
+	if got := b.Signs(1); got != nil {
+		t.Errorf("Signs(1) == %v; want nil", got)
+	}
+	if want, got := 0, b.SignLine(id); want != got {
+		t.Errorf("SignLine() == %v; want %v", got, want)
+	}
+}
+
+func TestBufferDisplayRows(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(4, 3)
+	b.Insert(b.End(), "ab\nabcdef\n")
+	sign := Sign{Text: "●"}
+	b.AddSign(2, sign)
+	b.Scroll(1)
+	want := []DisplayRow{
+		{[]Fragment{{"abcd", noneTag}}, 2, false, Index{2, 0}, []Sign{sign}},
+		{[]Fragment{{"ef", noneTag}}, 2, true, Index{2, 4}, nil},
+		{[]Fragment{{"", noneTag}}, 3, false, Index{3, 0}, nil},
+	}
+	if got := b.DisplayRows(); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayRows() == %v; want %v", got, want)
+	}
+
+	// rows past the end of the buffer
+	b.SetSize(4, 5)
+	if got := b.DisplayRows()[4]; !reflect.DeepEqual(DisplayRow{}, got) {
+		t.Errorf("DisplayRows()[4] == %v; want zero value", got)
+	}
+}
@@ -0,0 +1,113 @@
+package edit
+
+const (
+	highlightMargin = 100  // lines highlighted beyond the display
+	highlightChunk  = 1000 // lines highlighted at a time in the background
+)
+
+// invalidate marks the highlighting of line and following lines as invalid
+// in each view, and starts background highlighting if it is enabled.
+func (b *Buffer) invalidate(line int) {
+	for _, v := range b.views {
+		v.invalidate(line)
+	}
+}
+
+// invalidate marks the highlighting of line and following lines as invalid,
+// and starts background highlighting if it is enabled.
+func (v *View) invalidate(line int) {
+	if v.highlighted >= line {
+		v.highlighted = line - 1
+	}
+	if v.highlighted < v.b.lines.Len() {
+		v.b.startHighlighting()
+	}
+}
+
+// startHighlighting starts background highlighting if it is enabled and not
+// already running.
+func (b *Buffer) startHighlighting() {
+	if b.onHighlight != nil && !b.highlighting {
+		b.highlighting = true
+		go b.highlightInBackground()
+	}
+}
+
+// highlight applies the buffer's syntax to the lines up to line end that
+// don't have valid highlighting. A line's highlighting remains valid as long
+// as the line is unchanged and the syntax state at the end of the preceding
+// line is the same, so only lines affected by changes are highlighted again.
+// Lines that haven't been laid out are left for layOut.
+func (v *View) highlight(end int) {
+	b := v.b
+	if end > b.lines.Len() {
+		end = b.lines.Len()
+	}
+	if v.highlighted >= end {
+		return
+	}
+	state := noneState
+	if v.highlighted > 0 {
+		state = v.dLines.Get(v.highlighted).Value.(lineDisplay).end
+	}
+	v.dLines.Walk(v.highlighted+1, func(i int, n *node) bool {
+		display := n.Value.(lineDisplay)
+		if display.syntax != b.syntaxVersion || display.begin != state {
+			display.begin = state
+			display.fragments, display.end = nil, noneState // plain text
+			if len(b.syntax) > 0 {
+				text, _ := expand(b.lines.Line(i), v.tabWidth)
+				display.fragments, display.end =
+					b.syntax.split(string(text), state)
+			}
+			display.syntax = b.syntaxVersion
+			if display.rows != nil {
+				display = v.relayout(i, display)
+			}
+			v.set(i, display)
+		}
+		state = display.end
+		v.highlighted = i
+		return i < end
+	})
+}
+
+// highlightInBackground highlights the buffer's lines in each view a chunk at
+// a time until all of them are highlighted, then calls the background
+// highlighting callback.
+func (b *Buffer) highlightInBackground() {
+	for {
+		<-b.unlock
+		var v *View // view with the fewest highlighted lines
+		for _, view := range b.views {
+			if v == nil || view.highlighted < v.highlighted {
+				v = view
+			}
+		}
+		if v.highlighted >= b.lines.Len() || b.onHighlight == nil {
+			b.highlighting = false
+			fn := b.onHighlight
+			b.unlock <- 1
+			if fn != nil {
+				fn()
+			}
+			return
+		}
+		v.highlight(v.highlighted + highlightChunk)
+		b.unlock <- 1
+	}
+}
+
+// HighlightInBackground enables highlighting of the lines that are not on the
+// buffer's display in a separate goroutine. Otherwise, lines are only
+// highlighted when they are displayed. Each time the buffer's contents or
+// syntax change, the lines are highlighted again, and fn is called from the
+// goroutine once all of them are highlighted. If the lines are already
+// highlighted, fn is called immediately. If fn is nil, background
+// highlighting is disabled.
+func (b *Buffer) HighlightInBackground(fn func()) {
+	<-b.unlock
+	b.onHighlight = fn
+	b.startHighlighting()
+	b.unlock <- 1
+}
@@ -0,0 +1,92 @@
+package edit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// highlightedLines returns the number of lines in b that are highlighted.
+func highlightedLines(b *Buffer) int {
+	<-b.unlock
+	n := 0
+	b.view.dLines.Walk(1, func(_ int, node *node) bool {
+		if node.Value.(lineDisplay).syntax == b.syntaxVersion {
+			n++
+		}
+		return true
+	})
+	b.unlock <- 1
+	return n
+}
+
+func TestBufferLazyHighlight(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(20, 5)
+	commentRule, _ := NewRegionRule(`/\*`, `\*/`, 1)
+	b.SetSyntax([]Rule{commentRule})
+	b.Insert(b.End(), "/*"+strings.Repeat("\nline", 999))
+
+	// Only lines near the display are highlighted
+	b.DisplayLines()
+	if want, got := 5+highlightMargin, highlightedLines(b); want != got {
+		t.Errorf("%v lines highlighted; want %v", got, want)
+	}
+
+	// Displayed lines are highlighted using the state of preceding lines
+	b.Scroll(2000)
+	want := Fragment{"line", 1}
+	if got := b.DisplayLines()[0].Front().Value.(Fragment); want != got {
+		t.Errorf("DisplayLines returned %#v; want %#v", got, want)
+	}
+	if want, got := 1000, highlightedLines(b); want != got {
+		t.Errorf("%v lines highlighted; want %v", got, want)
+	}
+
+	// Edits invalidate highlighting of following lines
+	b.Delete(Index{1, 0}, Index{1, 1})
+	want = Fragment{"line", noneTag}
+	if got := b.DisplayLines()[0].Front().Value.(Fragment); want != got {
+		t.Errorf("DisplayLines returned %#v; want %#v", got, want)
+	}
+
+	// Background highlighting
+	done := make(chan int, 1)
+	b.HighlightInBackground(func() {
+		select {
+		case done <- 1:
+		default:
+		}
+	})
+	for _, f := range []func(){
+		func() {},
+		func() { b.Insert(Index{1, 0}, "/") },
+		func() { b.SetSyntax([]Rule{}) },
+	} {
+		f()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("background highlighting did not complete")
+		}
+		if want, got := 1000, highlightedLines(b); want != got {
+			t.Errorf("%v lines highlighted; want %v", got, want)
+		}
+	}
+	b.HighlightInBackground(nil)
+	b.Insert(Index{1, 0}, "/")
+	if highlightedLines(b) == 1000 {
+		t.Errorf("lines highlighted after disabling background highlighting")
+	}
+}
+
+// Current benchmark: 3 ms/op
+func BenchmarkLargeBufferSetSyntax(b *testing.B) {
+	buf := largeBuffer()
+	buf.SetSize(80, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.SetSyntax(goRules)
+		buf.DisplayLines()
+	}
+}
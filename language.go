@@ -0,0 +1,249 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// Language is a syntax definition for a language, giving rules for
+// highlighting it and how to recognize files written in it.
+type Language struct {
+	Name      string
+	Files     []string         // glob patterns matching base file names
+	FirstLine []*regexp.Regexp // patterns matching the first line of files
+	Rules     []Rule
+
+	// Tags holds the names of the tags applied by Rules: tag i is named
+	// Tags[i].
+	Tags []string
+}
+
+// TagName returns the name of tag, or the empty string if the language does
+// not define tag.
+func (l *Language) TagName(tag int) string {
+	if tag < 0 || tag >= len(l.Tags) {
+		return ""
+	}
+	return l.Tags[tag]
+}
+
+// tag returns the tag with name, adding it to l.Tags if necessary. The empty
+// name denotes no tag.
+func (l *Language) tag(name string) int {
+	if name == "" {
+		return noneTag
+	}
+	for i, tagName := range l.Tags {
+		if tagName == name {
+			return i
+		}
+	}
+	l.Tags = append(l.Tags, name)
+	return len(l.Tags) - 1
+}
+
+// DefinitionError reports a problem in a syntax definition.
+type DefinitionError struct {
+	Path string // location of problem in definition, e.g. "rules[2].end"
+	Err  string
+}
+
+func (e *DefinitionError) Error() string {
+	if e.Path == "" {
+		return "edit: syntax definition: " + e.Err
+	}
+	return fmt.Sprintf("edit: syntax definition: %s: %s", e.Path, e.Err)
+}
+
+// jsonLanguage is the JSON form of a Language.
+type jsonLanguage struct {
+	Name      string     `json:"name"`
+	Files     []string   `json:"files"`
+	FirstLine []string   `json:"firstLine"`
+	Rules     []jsonRule `json:"rules"`
+}
+
+// jsonRule is the JSON form of a Rule.
+type jsonRule struct {
+	Match    string   `json:"match"`
+	Begin    string   `json:"begin"`
+	End      string   `json:"end"`
+	Tag      string   `json:"tag"`
+	Captures []string `json:"captures"`
+}
+
+// ReadLanguage reads a Language defined in JSON from r. The definition is an
+// object of the following form:
+//
+//	{
+//		"name": "Go",
+//		"files": ["*.go"],
+//		"firstLine": ["^#!.*\\bgo run\\b"],
+//		"rules": [
+//			{"match": "\\b(func|var)\\b", "tag": "keyword"},
+//			{"begin": "/\\*", "end": "\\*/", "tag": "comment"},
+//			{"match": "(func) (\\w+)", "captures": ["keyword", "name"]}
+//		]
+//	}
+//
+// Files are glob patterns as accepted by path.Match. Rules are applied in
+// order, as by Buffer.SetSyntax. A rule either has a "match" pattern, in
+// which case it is created by NewCaptureRule with the tags named in
+// "captures", or "begin" and "end" patterns, in which case it is created by
+// NewRegionRule. Tags are numbered in order of first use, and an empty tag
+// name denotes no tag. Problems in the definition are reported with a
+// *DefinitionError.
+func ReadLanguage(r io.Reader) (*Language, error) {
+	var def jsonLanguage
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, &DefinitionError{Err: err.Error()}
+	}
+	if def.Name == "" {
+		return nil, &DefinitionError{"name", "missing"}
+	}
+	l := &Language{Name: def.Name, Files: def.Files}
+	for i, pattern := range def.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, &DefinitionError{fmt.Sprintf("files[%d]", i),
+				err.Error()}
+		}
+	}
+	for i, pattern := range def.FirstLine {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, &DefinitionError{fmt.Sprintf("firstLine[%d]", i),
+				err.Error()}
+		}
+		l.FirstLine = append(l.FirstLine, re)
+	}
+	for i, def := range def.Rules {
+		rule, err := l.rule(def)
+		if err != nil {
+			prefix := fmt.Sprintf("rules[%d]", i)
+			if err.Path == "" {
+				err.Path = prefix
+			} else {
+				err.Path = prefix + "." + err.Path
+			}
+			return nil, err
+		}
+		l.Rules = append(l.Rules, rule)
+	}
+	return l, nil
+}
+
+// rule returns the Rule defined by def. The path of a returned error is
+// relative to the rule.
+func (l *Language) rule(def jsonRule) (Rule, *DefinitionError) {
+	if def.Match != "" {
+		if def.Begin != "" || def.End != "" {
+			return Rule{}, &DefinitionError{"match",
+				"cannot be combined with begin or end"}
+		}
+		var captures []int // nil for plain match rules
+		for _, name := range def.Captures {
+			captures = append(captures, l.tag(name))
+		}
+		rule, err := NewCaptureRule(def.Match, l.tag(def.Tag), captures...)
+		if err != nil {
+			return Rule{}, &DefinitionError{"match", err.Error()}
+		}
+		return rule, nil
+	}
+	if def.Begin == "" {
+		return Rule{}, &DefinitionError{"", "missing match or begin"}
+	} else if def.End == "" {
+		return Rule{}, &DefinitionError{"end", "missing"}
+	} else if def.Captures != nil {
+		return Rule{}, &DefinitionError{"captures",
+			"not supported for begin and end rules"}
+	}
+	if _, err := regexp.Compile(def.Begin); err != nil {
+		return Rule{}, &DefinitionError{"begin", err.Error()}
+	}
+	rule, err := NewRegionRule(def.Begin, def.End, l.tag(def.Tag))
+	if err != nil {
+		return Rule{}, &DefinitionError{"end", err.Error()}
+	}
+	return rule, nil
+}
+
+// Registry is a thread-safe collection of Languages.
+type Registry struct {
+	languages []*Language
+	unlock    chan int // used as mutex
+}
+
+// NewRegistry initializes and returns a new empty Registry.
+func NewRegistry() *Registry {
+	r := &Registry{unlock: make(chan int, 1)}
+	r.unlock <- 1
+	return r
+}
+
+// Add adds l to the registry. Languages added later take precedence over
+// languages added earlier.
+func (r *Registry) Add(l *Language) {
+	<-r.unlock
+	r.languages = append(r.languages, l)
+	r.unlock <- 1
+}
+
+// Find returns the language for a file named filename whose first line is
+// firstLine, or nil if no language matches. Languages are matched first by
+// the base name of filename, then by firstLine.
+func (r *Registry) Find(filename, firstLine string) *Language {
+	<-r.unlock
+	l := r.find(filename, firstLine)
+	r.unlock <- 1
+	return l
+}
+
+func (r *Registry) find(filename, firstLine string) *Language {
+	base := filepath.Base(filename)
+	for i := len(r.languages) - 1; i >= 0; i-- {
+		for _, pattern := range r.languages[i].Files {
+			if ok, _ := path.Match(pattern, base); ok {
+				return r.languages[i]
+			}
+		}
+	}
+	for i := len(r.languages) - 1; i >= 0; i-- {
+		for _, re := range r.languages[i].FirstLine {
+			if re.MatchString(firstLine) {
+				return r.languages[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Languages returns the languages in the registry, in the order they were
+// added.
+func (r *Registry) Languages() []*Language {
+	<-r.unlock
+	languages := append([]*Language(nil), r.languages...)
+	r.unlock <- 1
+	return languages
+}
+
+// Load reads a Language defined in JSON from the named file, as by
+// ReadLanguage, and adds it to the registry.
+func (r *Registry) Load(filename string) (*Language, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := ReadLanguage(f)
+	if err != nil {
+		return nil, err
+	}
+	r.Add(l)
+	return l, nil
+}
@@ -0,0 +1,121 @@
+package edit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const testLanguage = `{
+	"name": "Go",
+	"files": ["*.go"],
+	"firstLine": ["^#!.*\\bgo run\\b"],
+	"rules": [
+		{"match": "(func) (\\w+)", "captures": ["keyword", "name"]},
+		{"match": "\\b(func|var)\\b", "tag": "keyword"},
+		{"begin": "/\\*", "end": "\\*/", "tag": "comment"}
+	]
+}`
+
+func TestReadLanguage(t *testing.T) {
+	l, err := ReadLanguage(strings.NewReader(testLanguage))
+	if err != nil {
+		t.Fatalf("ReadLanguage returned error: %v", err)
+	}
+	if want, got := []string{"keyword", "name", "comment"}, l.Tags; !reflect.DeepEqual(want, got) {
+		t.Errorf("Tags == %v; want %v", got, want)
+	}
+	if want, got := "name", l.TagName(1); want != got {
+		t.Errorf("TagName(1) returned %#v; want %#v", got, want)
+	}
+	if want, got := "", l.TagName(noneTag); want != got {
+		t.Errorf("TagName(noneTag) returned %#v; want %#v", got, want)
+	}
+	fragments, state := syntax(l.Rules).split("var /* func */ func f", noneState)
+	want := []Fragment{{"var", 0}, {" ", noneTag}, {"/* func */", 2},
+		{" ", noneTag}, {"func", 0}, {" ", noneTag}, {"f", 1}}
+	if !reflect.DeepEqual(want, fragments) || state != noneState {
+		t.Errorf("split returned %v, %v; want %v, %v", fragments, state,
+			want, noneState)
+	}
+	if l.Rules[1].captures != nil {
+		t.Errorf("plain match rule has captures %v; want nil",
+			l.Rules[1].captures)
+	}
+
+	// errors
+	for _, c := range []struct{ def, err string }{
+		{`{`, "edit: syntax definition: unexpected EOF"},
+		{`{"rules": []}`, "edit: syntax definition: name: missing"},
+		{`{"name": "x", "files": ["["]}`,
+			"edit: syntax definition: files[0]: syntax error in pattern"},
+		{`{"name": "x", "firstLine": ["("]}`, "edit: syntax definition: " +
+			"firstLine[0]: error parsing regexp: missing closing ): `(`"},
+		{`{"name": "x", "rules": [{"match": "a"}, {}]}`,
+			"edit: syntax definition: rules[1]: missing match or begin"},
+		{`{"name": "x", "rules": [{"begin": "a"}]}`,
+			"edit: syntax definition: rules[0].end: missing"},
+		{`{"name": "x", "rules": [{"match": "a", "end": "b"}]}`,
+			"edit: syntax definition: rules[0].match: " +
+				"cannot be combined with begin or end"},
+		{`{"name": "x", "rules": [{"begin": "a", "end": "(", "tag": "t"}]}`,
+			"edit: syntax definition: rules[0].end: " +
+				"error parsing regexp: missing closing ): `(`"},
+	} {
+		_, err := ReadLanguage(strings.NewReader(c.def))
+		if err == nil {
+			t.Errorf("ReadLanguage(%#q) returned nil error", c.def)
+		} else if err.Error() != c.err {
+			t.Errorf("ReadLanguage(%#q) returned error %#q; want %#q", c.def,
+				err.Error(), c.err)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "go.json")
+	if err := ioutil.WriteFile(filename, []byte(testLanguage), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	goLang, err := r.Load(filename)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, err := r.Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Load returned nil error for missing file")
+	}
+	shLang := &Language{Name: "sh", Files: []string{"*.sh", "*.bash"},
+		FirstLine: []*regexp.Regexp{regexp.MustCompile(`^#!.*sh\b`)}}
+	r.Add(shLang)
+
+	for _, c := range []struct {
+		filename, firstLine string
+		want                *Language
+	}{
+		{"/src/main.go", "package main", goLang},
+		{"script.bash", "", shLang},
+		{"script", "#!/bin/sh", shLang},
+		{"script", "#!/usr/bin/env go run", goLang},
+		{"main.go", "#!/bin/sh", goLang}, // filename takes precedence
+		{"README", "Hello", nil},
+	} {
+		if got := r.Find(c.filename, c.firstLine); got != c.want {
+			t.Errorf("Find(%#v, %#v) returned %v; want %v", c.filename,
+				c.firstLine, got, c.want)
+		}
+	}
+	if want, got := []*Language{goLang, shLang}, r.Languages(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Languages returned %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,339 @@
+package edit
+
+import "unicode"
+
+// WrapTag is the tag of the fragment displayed at the beginning of
+// continuation rows of a wrapped line, which holds the wrap indent and
+// marker.
+const WrapTag = -2
+
+// WrapMode determines how lines wider than the display are wrapped.
+type WrapMode int
+
+// Wrap modes.
+const (
+	// HardWrap breaks lines at the last column that fits.
+	HardWrap WrapMode = iota
+
+	// WordWrap breaks lines after white space and punctuation, and between
+	// wide characters, when possible. White space at the end of a row may
+	// extend past the display's width rather than beginning the next row;
+	// the display coordinates of indexes in it are clamped to the width.
+	WordWrap
+
+	// NoWrap displays each line on a single row, however wide.
+	NoWrap
+)
+
+// WrapOptions holds configuration for wrapping lines.
+type WrapOptions struct {
+	Mode   WrapMode
+	Indent bool   // if true, continuation rows inherit the line's indentation
+	Marker string // displayed at the beginning of continuation rows, e.g. "↪"
+}
+
+// lineLayout is the arrangement of a line's grapheme clusters, and those of
+// its annotations, into display rows.
+type lineLayout struct {
+	text        []rune // expanded text
+	cells       []cell
+	length      int          // length of the line, in runes
+	annotations []Annotation // annotations in order of display
+	virtual     [][]rune     // expanded text of annotations
+	starts      []int        // index of the first cell of each row
+	cols        []int        // column of each cell in its row
+	prefix      string       // text displayed at the beginning of continuation rows
+	mode        WrapMode
+	width       int // width of the display
+}
+
+// layout returns the layout of line i, whose text is line, under the view's
+// display settings.
+func (v *View) layout(i int, line []rune) *lineLayout {
+	l := &lineLayout{length: len(line), starts: []int{0}, mode: v.wrap.Mode,
+		width: v.cols}
+	l.text, l.cells = expand(line, v.tabWidth)
+	if l.annotations = v.b.annotationsOn(i); l.annotations != nil {
+		v.annotate(l)
+	}
+	l.cols = make([]int, len(l.cells))
+	if v.wrap.Mode == NoWrap {
+		col := 0
+		for i, c := range l.cells {
+			l.cols[i] = col
+			col += c.width
+		}
+		return l
+	}
+
+	prefixWidth := v.wrapPrefix(l)
+	start, col := 0, 0 // first cell and next column of the current row
+	for i, c := range l.cells {
+		for i > start && col+c.width > v.cols &&
+			!(v.wrap.Mode == WordWrap && l.isSpace(i)) {
+			// Begin a new row, at the last break opportunity if wrapping
+			// words
+			k := i
+			if v.wrap.Mode == WordWrap {
+				for j := i; j > start; j-- {
+					if l.canBreak(j) {
+						k = j
+						break
+					}
+				}
+			}
+			l.starts = append(l.starts, k)
+			start, col = k, prefixWidth
+			for j := k; j < i; j++ {
+				l.cols[j] = col
+				col += l.cells[j].width
+			}
+		}
+		l.cols[i] = col
+		col += c.width
+	}
+	return l
+}
+
+// wrapPrefix sets the prefix of continuation rows of l and returns its
+// width. The indent or marker is omitted if it would take more than half of
+// the display's width.
+func (v *View) wrapPrefix(l *lineLayout) int {
+	indent := 0
+	if v.wrap.Indent {
+		for i := range l.cells {
+			if !l.isSpace(i) {
+				break
+			}
+			indent += l.cells[i].width
+		}
+	}
+	marker, markerWidth := []rune(v.wrap.Marker), 0
+	_, cells := expand(marker, v.tabWidth)
+	for _, c := range cells {
+		markerWidth += c.width
+	}
+	if indent+markerWidth > v.cols/2 {
+		indent = 0
+		if markerWidth > v.cols/2 {
+			marker, markerWidth = nil, 0
+		}
+	}
+	prefix := make([]rune, indent, indent+len(marker))
+	for i := range prefix {
+		prefix[i] = ' '
+	}
+	l.prefix = string(append(prefix, marker...))
+	return indent + markerWidth
+}
+
+// annotate adds cells for the annotations of l. An inline annotation is
+// displayed before the first cluster that begins at or after its index.
+func (v *View) annotate(l *lineLayout) {
+	cells := make([]cell, 0, len(l.cells))
+	k := 0 // next annotation
+	add := func(char int) {
+		text, virtual := expand([]rune(l.annotations[k].Text), v.tabWidth)
+		l.virtual = append(l.virtual, text)
+		for _, c := range virtual {
+			c.char, c.virtual = char, k+1
+			cells = append(cells, c)
+		}
+		k++
+	}
+	for _, c := range l.cells {
+		for k < len(l.annotations) && !l.annotations[k].EndOfLine &&
+			l.annotations[k].Index.Char <= c.char {
+			add(c.char)
+		}
+		cells = append(cells, c)
+	}
+	for k < len(l.annotations) {
+		add(l.length)
+	}
+	l.cells = cells
+}
+
+// rune returns the first rune of cell i.
+func (l *lineLayout) rune(i int) rune {
+	if c := l.cells[i]; c.virtual != 0 {
+		return l.virtual[c.virtual-1][c.offset]
+	}
+	return l.text[l.cells[i].offset]
+}
+
+// isSpace reports whether cell i is white space.
+func (l *lineLayout) isSpace(i int) bool {
+	return unicode.IsSpace(l.rune(i))
+}
+
+// canBreak reports whether a line can be wrapped before cell i, which must
+// be > 0, in word wrap mode.
+func (l *lineLayout) canBreak(i int) bool {
+	prev := l.rune(i - 1)
+	switch {
+	case l.isSpace(i):
+		return false
+	case l.isSpace(i - 1):
+		return true
+	case unicode.IsPunct(prev) && !unicode.In(prev, unicode.Ps, unicode.Pi):
+		return true
+	}
+	return l.cells[i-1].width > 1 || l.cells[i].width > 1
+}
+
+// plain returns the text of the expanded line as a single untagged
+// fragment.
+func (l *lineLayout) plain() []Fragment {
+	return []Fragment{{string(l.text), noneTag}}
+}
+
+// rows wraps fragments, the tagged text of the expanded line, and the
+// line's annotations into display rows.
+func (l *lineLayout) rows(fragments []Fragment) []fragList {
+	if len(l.cells) == 0 {
+		tag := noneTag
+		if len(fragments) > 0 {
+			tag = fragments[0].Tag
+		}
+		return []fragList{{{"", tag}}}
+	}
+
+	// tag of each rune of the expanded line
+	tags := make([]int, 0, len(l.text))
+	for _, frag := range fragments {
+		for range frag.Text {
+			tags = append(tags, frag.Tag)
+		}
+	}
+	for len(tags) < len(l.text) {
+		tags = append(tags, noneTag)
+	}
+
+	rows := []fragList{{}}
+	var text []rune // text of the fragment being built
+	tag := noneTag
+	flush := func() {
+		if len(text) > 0 {
+			rows[len(rows)-1] = append(rows[len(rows)-1],
+				Fragment{string(text), tag})
+			text = text[:0]
+		}
+	}
+	for i, c := range l.cells {
+		if len(rows) < len(l.starts) && i == l.starts[len(rows)] {
+			flush()
+			row := fragList{}
+			if l.prefix != "" {
+				row = append(row, Fragment{l.prefix, WrapTag})
+			}
+			rows = append(rows, row)
+		}
+		if c.virtual != 0 {
+			if t := l.annotations[c.virtual-1].Tag; t != tag {
+				flush()
+				tag = t
+			}
+			text = append(text, l.virtual[c.virtual-1][c.offset:c.offset+c.n]...)
+			continue
+		}
+		for j := c.offset; j < c.offset+c.n; j++ {
+			if tags[j] != tag {
+				flush()
+				tag = tags[j]
+			}
+			text = append(text, l.text[j])
+		}
+	}
+	flush()
+	return rows
+}
+
+// coords returns the display row, relative to the first row of the line,
+// and column of char. When hard wrapping, the end of a full row is at the
+// beginning of the next row, as if the line continued; otherwise the end of
+// the line is just past its last cell. When wrapping words, columns of white
+// space hanging past the display's width are clamped to the width.
+func (l *lineLayout) coords(char int) (col, row int) {
+	for i, c := range l.cells {
+		if row+1 < len(l.starts) && i == l.starts[row+1] {
+			row++
+		}
+		if c.char >= char {
+			return l.clamp(l.cols[i]), row
+		}
+	}
+	if n := len(l.cells); n > 0 {
+		col = l.cols[n-1] + l.cells[n-1].width
+	}
+	if l.mode == HardWrap && len(l.cells) > 0 && col >= l.width {
+		return 0, row + 1
+	}
+	return l.clamp(col), row
+}
+
+// clamp returns col, or the display's width if col is past it and words are
+// wrapped.
+func (l *lineLayout) clamp(col int) int {
+	if l.mode == WordWrap && col > l.width {
+		return l.width
+	}
+	return col
+}
+
+// charAt returns the index of the character displayed at col in a row,
+// relative to the first row of the line. Coordinates before the first cell
+// of a row are at that cell, and coordinates past the end of a row are at
+// the beginning of the next row, or at the end of the line.
+func (l *lineLayout) charAt(col, row int) int {
+	if row >= len(l.starts) {
+		return l.length
+	}
+	end := len(l.cells)
+	if row+1 < len(l.starts) {
+		end = l.starts[row+1]
+	}
+	for i := l.starts[row]; i < end; i++ {
+		if col < l.cols[i]+l.cells[i].width {
+			return l.cells[i].char
+		}
+	}
+	if end < len(l.cells) {
+		return l.cells[end].char
+	}
+	return l.length
+}
+
+// clipRow returns the part of a display row between columns begin and end.
+// The visible columns of a wide character that is only partly visible are
+// replaced by spaces.
+func clipRow(row fragList, begin, end int) fragList {
+	var clipped fragList
+	col := 0
+	for _, frag := range row {
+		text := []rune(frag.Text)
+		var visible []rune
+		for len(text) > 0 && col < end {
+			n := clusterLen(text)
+			w := clusterWidth(text[:n])
+			switch {
+			case col >= begin && col+w <= end:
+				visible = append(visible, text[:n]...)
+			case col+w > begin:
+				for c := col; c < col+w; c++ {
+					if c >= begin && c < end {
+						visible = append(visible, ' ')
+					}
+				}
+			}
+			text, col = text[n:], col+w
+		}
+		if len(visible) > 0 {
+			clipped = append(clipped, Fragment{string(visible), frag.Tag})
+		}
+		if col >= end {
+			break
+		}
+	}
+	return clipped
+}
@@ -0,0 +1,139 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBufferWrap(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(10, 6)
+	b.Insert(b.End(), "  foo bar-baz qux\n日本語の文章です")
+
+	b.SetWrap(WrapOptions{Mode: WordWrap})
+	want := [][]Fragment{{{"  foo bar-", noneTag}}, {{"baz qux", noneTag}},
+		{{"日本語の文", noneTag}}, {{"章です", noneTag}}, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	b.SetSize(8, 6)
+	b.SetWrap(WrapOptions{Mode: WordWrap, Indent: true, Marker: "↪"})
+	want = [][]Fragment{{{"  foo ", noneTag}}, {{"  ↪", WrapTag},
+		{"bar-", noneTag}}, {{"  ↪", WrapTag}, {"baz ", noneTag}},
+		{{"  ↪", WrapTag}, {"qux", noneTag}}, {{"日本語の", noneTag}},
+		{{"↪", WrapTag}, {"文章で", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	b.SetWrap(WrapOptions{Mode: NoWrap})
+	want = [][]Fragment{{{"  foo ba", noneTag}}, {{"日本語の", noneTag}},
+		nil, nil, nil, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	if col, row := b.CoordsFromIndex(Index{2, 8}); col != 16 || row != 1 {
+		t.Errorf("CoordsFromIndex() == %v, %v; want 16, 1", col, row)
+	}
+}
+
+func TestBufferScrollColumns(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(8, 2)
+	b.Insert(b.End(), "  foo bar-baz qux\n日本語の文章です")
+
+	// no horizontal scrolling when wrapping
+	b.ScrollColumns(3)
+	if want, got := 0, b.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+
+	b.SetWrap(WrapOptions{Mode: NoWrap})
+	b.ScrollColumns(3)
+	if want, got := 3, b.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+	want := [][]Fragment{{{"oo bar-b", noneTag}}, {{" 語の文 ", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	if col, row := b.CoordsFromIndex(Index{2, 3}); col != 3 || row != 1 {
+		t.Errorf("CoordsFromIndex() == %v, %v; want 3, 1", col, row)
+	}
+	if want, got := (Index{2, 1}), b.IndexFromCoords(0, 1); want != got {
+		t.Errorf("IndexFromCoords() == %v; want %v", got, want)
+	}
+	if want, got := (Index{1, 0}), b.IndexFromCoords(-5, 0); want != got {
+		t.Errorf("IndexFromCoords() == %v; want %v", got, want)
+	}
+
+	b.ScrollColumns(-10)
+	if want, got := 0, b.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+	b.ScrollColumns(2)
+	b.SetWrap(WrapOptions{})
+	if want, got := 0, b.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+}
+
+func TestBufferWrapCoords(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(7, 100)
+	b.Insert(b.End(), "\tone two,three\n  日本語の文章です\n\n"+
+		"x    y   \nabcdefghijklmno\néééééééé")
+	for _, opts := range []WrapOptions{
+		{Mode: HardWrap},
+		{Mode: WordWrap},
+		{Mode: WordWrap, Indent: true, Marker: ">"},
+		{Mode: HardWrap, Indent: true, Marker: "↪"},
+		{Mode: NoWrap},
+	} {
+		b.SetWrap(opts)
+		prevCol, prevRow := -1, -1
+		for index := (Index{1, 0}); ; {
+			col, row := b.CoordsFromIndex(index)
+			got := b.IndexFromCoords(col, row)
+			switch {
+			case col == prevCol && row == prevRow:
+				// hanging white space, clamped to the display's width
+			case got == (Index{index.Line + 1, 0}) && col == 0:
+				// end of a full row, at the beginning of the next row
+			case index != got:
+				t.Errorf("%+v: IndexFromCoords(CoordsFromIndex(%v)) == %v",
+					opts, index, got)
+			}
+			next := b.ShiftClusters(index, 1)
+			if next == index {
+				break
+			}
+			index, prevCol, prevRow = next, col, row
+		}
+	}
+
+	b = NewBuffer()
+	b.SetSize(4, 10)
+	b.Insert(b.End(), "abcd\nab      cd")
+	for _, c := range []struct {
+		mode     WrapMode
+		index    Index
+		col, row int
+	}{
+		{HardWrap, Index{1, 4}, 0, 1},
+		{HardWrap, Index{2, 6}, 2, 2},
+		{WordWrap, Index{1, 4}, 4, 0},
+		{WordWrap, Index{2, 4}, 4, 1},
+		{WordWrap, Index{2, 6}, 4, 1},
+		{WordWrap, Index{2, 8}, 0, 2},
+		{NoWrap, Index{1, 4}, 4, 0},
+		{NoWrap, Index{2, 6}, 6, 1},
+	} {
+		b.SetWrap(WrapOptions{Mode: c.mode})
+		if col, row := b.CoordsFromIndex(c.index); col != c.col || row != c.row {
+			t.Errorf("%v: CoordsFromIndex(%v) == %v, %v; want %v, %v",
+				c.mode, c.index, col, row, c.col, c.row)
+		}
+	}
+}
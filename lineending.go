@@ -0,0 +1,90 @@
+package edit
+
+import (
+	"io"
+	"strings"
+)
+
+// LineEnding denotes a style of line terminator.
+type LineEnding int
+
+// Styles of line terminator.
+const (
+	LF   LineEnding = iota // "\n", as used on Unix-like systems
+	CRLF                   // "\r\n", as used on Windows
+	CR                     // "\r", as used on classic Mac OS
+)
+
+const noEnding LineEnding = -1
+
+// String returns the line terminator denoted by the LineEnding.
+func (le LineEnding) String() string {
+	switch le {
+	case CRLF:
+		return "\r\n"
+	case CR:
+		return "\r"
+	}
+	return "\n"
+}
+
+// readLine reads runes from r up to and including the next line terminator.
+// It returns the line text without the terminator, the style of the
+// terminator (noEnding if the line ended at EOF or on error), and the number
+// of bytes consumed.
+func readLine(r io.RuneScanner) (text []rune, le LineEnding, n int,
+	err error) {
+	le = noEnding
+	for {
+		var ch rune
+		var size int
+		if ch, size, err = r.ReadRune(); err != nil {
+			return
+		}
+		n += size
+		switch ch {
+		case '\n':
+			le = LF
+			return
+		case '\r':
+			le = CR
+			if ch, size, err = r.ReadRune(); err != nil {
+				return
+			}
+			if ch == '\n' {
+				le = CRLF
+				n += size
+			} else {
+				err = r.UnreadRune()
+			}
+			return
+		}
+		text = append(text, ch)
+	}
+}
+
+// dominantEnding returns the most frequent line ending in counts, which is
+// indexed by LineEnding, and whether more than one style occurred. Ties are
+// broken in favor of LF, then CRLF. If no line endings occurred, LF is
+// returned.
+func dominantEnding(counts [3]int) (le LineEnding, mixed bool) {
+	styles := 0
+	for i, n := range counts {
+		if n > 0 {
+			styles++
+		}
+		if n > counts[le] {
+			le = LineEnding(i)
+		}
+	}
+	return le, styles > 1
+}
+
+// normalizeEndings converts all line terminators in s to "\n".
+func normalizeEndings(s string) string {
+	if strings.IndexByte(s, '\r') < 0 {
+		return s
+	}
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Replace(s, "\r", "\n", -1)
+}
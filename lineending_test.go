@@ -0,0 +1,52 @@
+package edit
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("a\nb\r\nc\rd"))
+	lines := []struct {
+		text string
+		le   LineEnding
+		n    int
+	}{{"a", LF, 2}, {"b", CRLF, 3}, {"c", CR, 2}, {"d", noEnding, 1}}
+	for _, want := range lines {
+		text, le, n, _ := readLine(r)
+		if string(text) != want.text || le != want.le || n != want.n {
+			t.Errorf("readLine() == %#v, %v, %v; want %#v, %v, %v",
+				string(text), le, n, want.text, want.le, want.n)
+		}
+	}
+
+	// CR at EOF
+	r = bufio.NewReader(strings.NewReader("a\r"))
+	if text, le, _, _ := readLine(r); string(text) != "a" || le != CR {
+		t.Errorf("readLine() == %#v, %v; want %#v, %v", string(text), le,
+			"a", CR)
+	}
+}
+
+func TestDominantEnding(t *testing.T) {
+	if le, mixed := dominantEnding([3]int{0, 0, 0}); le != LF || mixed {
+		t.Errorf("dominantEnding() == %v, %v; want %v, %v", le, mixed, LF,
+			false)
+	}
+	if le, mixed := dominantEnding([3]int{0, 3, 0}); le != CRLF || mixed {
+		t.Errorf("dominantEnding() == %v, %v; want %v, %v", le, mixed, CRLF,
+			false)
+	}
+	if le, mixed := dominantEnding([3]int{1, 1, 2}); le != CR || !mixed {
+		t.Errorf("dominantEnding() == %v, %v; want %v, %v", le, mixed, CR,
+			true)
+	}
+}
+
+func TestNormalizeEndings(t *testing.T) {
+	want := "a\nb\nc\n\nd"
+	if got := normalizeEndings("a\r\nb\nc\r\rd"); want != got {
+		t.Errorf("normalizeEndings() == %#v; want %#v", got, want)
+	}
+}
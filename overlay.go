@@ -0,0 +1,131 @@
+package edit
+
+// Overlay applies a tag to a range of text on the display, on top of the tags
+// applied by the buffer's syntax, such as for a selection or search results.
+// Tag is usually a display tag, so that a Theme can style it apart from
+// syntax tags; see DisplayTag.
+type Overlay struct {
+	Begin, End Index
+	Tag        int
+	Priority   int // overlays with higher priority take precedence
+}
+
+// AddOverlays adds overlays to the buffer's display and returns their IDs.
+// Like marks, the ranges of overlays are automatically updated when the
+// buffer contents are modified. Adding and removing overlays doesn't require
+// any text to be laid out or highlighted again, so it is cheap even for many
+// overlays.
+func (b *Buffer) AddOverlays(overlays ...Overlay) []int {
+	<-b.unlock
+	ids := make([]int, len(overlays))
+	for i, o := range overlays {
+		o.Begin, o.End = b.clip(o.Begin), b.clip(o.End)
+		if o.End.Less(o.Begin) {
+			o.Begin, o.End = o.End, o.Begin
+		}
+		b.nextOverlay++
+		b.overlays[b.nextOverlay] = o
+		ids[i] = b.nextOverlay
+	}
+	b.unlock <- 1
+	return ids
+}
+
+// RemoveOverlays removes the overlays with the given IDs, if they exist.
+func (b *Buffer) RemoveOverlays(id ...int) {
+	<-b.unlock
+	for _, id := range id {
+		delete(b.overlays, id)
+	}
+	b.unlock <- 1
+}
+
+// OverlayRange returns the current range of the overlay with ID id, or
+// zero-value indexes if no overlay with ID id exists.
+func (b *Buffer) OverlayRange(id int) (begin, end Index) {
+	<-b.unlock
+	o := b.overlays[id]
+	b.unlock <- 1
+	return o.Begin, o.End
+}
+
+// moveOverlays updates the ranges of overlays after an edit using move,
+// which returns the new position of an index.
+func (b *Buffer) moveOverlays(move func(Index) Index) {
+	for id, o := range b.overlays {
+		o.Begin, o.End = move(o.Begin), move(o.End)
+		b.overlays[id] = o
+	}
+}
+
+// overlay returns the rows of display, the display of line i, with the tags
+// of overlays applied. Overlays don't apply to wrap prefixes, fold
+// placeholders, or annotations.
+func (v *View) overlay(i int, display lineDisplay) []fragList {
+	var ids []int
+	for id, o := range v.b.overlays {
+		if o.Begin.Line <= i && o.End.Line >= i && o.Begin != o.End {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return display.rows
+	}
+
+	// Find the overlay applied to each rune of the expanded line
+	l := v.layout(i, v.b.lines.Line(i))
+	applied := make([]int, len(l.text)) // IDs of overlays; 0 for none
+	offset := func(char int) int {
+		for _, c := range l.cells {
+			if c.virtual == 0 && c.char >= char {
+				return c.offset
+			}
+		}
+		return len(l.text)
+	}
+	for _, id := range ids {
+		o := v.b.overlays[id]
+		begin, end := 0, len(l.text)
+		if o.Begin.Line == i {
+			begin = offset(o.Begin.Char)
+		}
+		if o.End.Line == i {
+			end = offset(o.End.Char)
+		}
+		for j := begin; j < end; j++ {
+			k := applied[j]
+			if k == 0 || o.Priority > v.b.overlays[k].Priority ||
+				o.Priority == v.b.overlays[k].Priority && id > k {
+				applied[j] = id
+			}
+		}
+	}
+
+	// Split fragments where the applied overlay changes, then wrap them
+	fragments := display.fragments
+	if fragments == nil {
+		fragments = l.plain()
+	}
+	var overlaid []Fragment
+	pos := 0
+	for _, frag := range fragments {
+		text := []rune(frag.Text)
+		start := 0
+		for j := 1; j <= len(text); j++ {
+			if j < len(text) && applied[pos+j] == applied[pos+start] {
+				continue
+			}
+			tag := frag.Tag
+			if id := applied[pos+start]; id != 0 {
+				tag = v.b.overlays[id].Tag
+			}
+			overlaid = append(overlaid, Fragment{string(text[start:j]), tag})
+			start = j
+		}
+		if len(text) == 0 {
+			overlaid = append(overlaid, frag)
+		}
+		pos += len(text)
+	}
+	return l.rows(overlaid)
+}
@@ -0,0 +1,47 @@
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBufferOverlays(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(4, 4)
+	rule, _ := NewRule(`b`, 1)
+	b.SetSyntax([]Rule{rule})
+	b.Insert(b.End(), "abcdef\n\txy")
+
+	selection, search := DisplayTag("selection"), DisplayTag("search")
+	ids := b.AddOverlays(
+		Overlay{Index{1, 1}, Index{2, 1}, selection, 0},
+		Overlay{Index{1, 3}, Index{1, 1}, search, 1}, // reversed
+	)
+	want := [][]Fragment{{{"a", noneTag}, {"bc", search}, {"d", selection}},
+		{{"ef", selection}}, {{"    ", selection}}, {{"    ", selection}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// overlays follow edits
+	b.Insert(Index{1, 0}, "__")
+	if begin, end := b.OverlayRange(ids[1]); begin != (Index{1, 3}) ||
+		end != (Index{1, 5}) {
+		t.Errorf("OverlayRange() == %v, %v; want {1 3}, {1 5}", begin, end)
+	}
+	b.Delete(Index{1, 0}, Index{1, 4})
+	if begin, end := b.OverlayRange(ids[1]); begin != (Index{1, 0}) ||
+		end != (Index{1, 1}) {
+		t.Errorf("OverlayRange() == %v, %v; want {1 0}, {1 1}", begin, end)
+	}
+
+	b.RemoveOverlays(ids...)
+	b.SetWrap(WrapOptions{Mode: WordWrap, Marker: ">"})
+	b.AddOverlays(Overlay{Index{1, 3}, Index{2, 2}, selection, 0})
+	want = [][]Fragment{{{"cde", noneTag}, {"f", selection}},
+		{{"        ", selection}},
+		{{">", WrapTag}, {"x", selection}, {"y", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+}
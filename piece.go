@@ -0,0 +1,289 @@
+package edit
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// piece is a span of UTF-8 text in either the original or the add buffer of
+// a pieceStore.
+type piece struct {
+	add        bool // true if the span is in the add buffer
+	start, end int  // byte offsets of the span
+}
+
+// pieceLine is a line of text in a pieceStore, composed of pieces.
+type pieceLine struct {
+	pieces []piece
+	length int // length in runes, or -1 if not counted yet
+}
+
+// pieceStore is a lineStore implemented as a piece table: lines refer to
+// spans of the original loaded bytes, which are never modified, and of an
+// append-only buffer holding inserted text. Memory use is proportional to the
+// size of the original text plus the size of the edits.
+type pieceStore struct {
+	orig, add []byte
+	lines     *tree // tree of pieceLines
+}
+
+func newPieceStore() *pieceStore {
+	s := &pieceStore{lines: newTree()}
+	s.lines.PushBack(pieceLine{}, 1)
+	return s
+}
+
+// bytes returns the text referred to by p.
+func (s *pieceStore) bytes(p piece) []byte {
+	if p.add {
+		return s.add[p.start:p.end]
+	}
+	return s.orig[p.start:p.end]
+}
+
+// appendLine appends the text of line to runes.
+func (s *pieceStore) appendLine(runes []rune, line pieceLine) []rune {
+	for _, p := range line.pieces {
+		for b := s.bytes(p); len(b) > 0; {
+			ch, size := utf8.DecodeRune(b)
+			runes = append(runes, ch)
+			b = b[size:]
+		}
+	}
+	return runes
+}
+
+// split splits the pieces of line at rune offset char.
+func (s *pieceStore) split(line pieceLine, char int) (head, tail []piece) {
+	for i, p := range line.pieces {
+		n := utf8.RuneCount(s.bytes(p))
+		if char >= n {
+			char -= n
+			continue
+		}
+		offset := p.start
+		for b := s.bytes(p); char > 0; char-- {
+			_, size := utf8.DecodeRune(b)
+			offset += size
+			b = b[size:]
+		}
+		head = append(head, line.pieces[:i]...)
+		tail = append(tail, line.pieces[i+1:]...)
+		if offset > p.start {
+			head = append(head, piece{p.add, p.start, offset})
+		}
+		tail = append([]piece{{p.add, offset, p.end}}, tail...)
+		return
+	}
+	return append(head, line.pieces...), nil
+}
+
+// addPiece appends text to the add buffer and appends a piece referring to
+// it to pieces, extending the last piece instead if possible.
+func (s *pieceStore) addPiece(pieces []piece, text string) []piece {
+	if text == "" {
+		return pieces
+	}
+	start := len(s.add)
+	s.add = append(s.add, text...)
+	if n := len(pieces); n > 0 && pieces[n-1].add && pieces[n-1].end == start {
+		pieces[n-1].end = len(s.add)
+		return pieces
+	}
+	return append(pieces, piece{true, start, len(s.add)})
+}
+
+// line returns line n, counting its length in runes if it hasn't been
+// counted. Lines are counted when they are created by edits, but loaded lines
+// are only counted when they are first used, and the count is stored.
+func (s *pieceStore) line(n int) pieceLine {
+	line := s.lines.Get(n).Value.(pieceLine)
+	if line.length < 0 {
+		line.length = 0
+		for _, p := range line.pieces {
+			line.length += utf8.RuneCount(s.bytes(p))
+		}
+		s.lines.Set(n, line, 1)
+	}
+	return line
+}
+
+// newLine returns a pieceLine composed of pieces.
+func (s *pieceStore) newLine(pieces []piece) pieceLine {
+	line := pieceLine{pieces: pieces}
+	for _, p := range pieces {
+		line.length += utf8.RuneCount(s.bytes(p))
+	}
+	return line
+}
+
+func (s *pieceStore) Len() int {
+	return s.lines.Len()
+}
+
+func (s *pieceStore) Line(n int) []rune {
+	line := s.line(n)
+	return s.appendLine(make([]rune, 0, line.length), line)
+}
+
+func (s *pieceStore) LineLen(n int) int {
+	return s.line(n).length
+}
+
+func (s *pieceStore) Walk(n int, fn func(n int, text []rune) bool) {
+	var text []rune
+	s.lines.Walk(n, func(i int, elem *node) bool {
+		text = s.appendLine(text[:0], elem.Value.(pieceLine))
+		return fn(i, text)
+	})
+}
+
+func (s *pieceStore) Insert(index Index, lines []string) {
+	head, tail := s.split(s.lines.Get(index.Line).Value.(pieceLine),
+		index.Char)
+	for i, line := range lines {
+		var pieces []piece
+		if i == 0 {
+			pieces = head
+		}
+		pieces = s.addPiece(pieces, line)
+		if i == len(lines)-1 {
+			pieces = append(pieces, tail...)
+		}
+		if i == 0 {
+			s.lines.Set(index.Line, s.newLine(pieces), 1)
+		} else {
+			s.lines.Insert(index.Line+i, s.newLine(pieces), 1)
+		}
+	}
+}
+
+func (s *pieceStore) Delete(begin, end Index) {
+	head, _ := s.split(s.lines.Get(begin.Line).Value.(pieceLine), begin.Char)
+	_, tail := s.split(s.lines.Get(end.Line).Value.(pieceLine), end.Char)
+	if end.Line > begin.Line {
+		s.lines.Remove(begin.Line+1, end.Line)
+	}
+	s.lines.Set(begin.Line, s.newLine(append(head, tail...)), 1)
+}
+
+func (s *pieceStore) Init() {
+	s.orig, s.add = nil, nil
+	s.lines.Init()
+}
+
+func (s *pieceStore) PushBack(text []rune) {
+	s.lines.PushBack(s.newLine(s.addPiece(nil, string(text))), 1)
+}
+
+// load reads UTF-8 text from r until EOF and appends its lines to the store,
+// referring to the loaded bytes directly. If size is positive, it is the
+// expected number of bytes, for which space is allocated in advance. The
+// number of each style of line ending is added to counts. Invalid UTF-8
+// input is reported with a *DecodeError, whose offset is relative to the
+// beginning of r. Only text preceding the invalid input is loaded, and the
+// number of bytes returned is its length. Lines are only split, not decoded;
+// their lengths in runes are counted and stored when they are first used.
+func (s *pieceStore) load(r io.Reader, size int, counts *[3]int) (n int64,
+	err error) {
+	s.orig = make([]byte, 0, size+1) // room to read EOF without growing
+	valid := 0                       // length of the validated prefix
+	for err == nil {
+		if len(s.orig) == cap(s.orig) {
+			s.orig = append(s.orig, 0)[:len(s.orig)]
+		}
+		var m int
+		m, err = r.Read(s.orig[len(s.orig):cap(s.orig)])
+		s.orig = s.orig[:len(s.orig)+m]
+
+		// validate the bytes read, except a rune split by the end of the
+		// read, which is validated with the following bytes
+		end := len(s.orig)
+		for i := end - 1; err == nil && i >= valid && i > end-utf8.UTFMax; i-- {
+			if utf8.RuneStart(s.orig[i]) {
+				if !utf8.FullRune(s.orig[i:]) {
+					end = i
+				}
+				break
+			}
+		}
+		if utf8.Valid(s.orig[valid:end]) {
+			valid = end
+			continue
+		}
+		for valid < end {
+			ch, w := utf8.DecodeRune(s.orig[valid:end])
+			if ch == utf8.RuneError && w < 2 {
+				break
+			}
+			valid += w
+		}
+		err = &DecodeError{Offset: int64(valid), Encoding: UTF8}
+		s.orig = s.orig[:valid]
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	n = int64(len(s.orig))
+
+	// split lines, finding each line terminator byte only once
+	next := func(c byte, i int) int {
+		if k := bytes.IndexByte(s.orig[i:], c); k >= 0 {
+			return i + k
+		}
+		return len(s.orig)
+	}
+	lf, cr := next('\n', 0), next('\r', 0)
+	for start := 0; ; {
+		if lf < start {
+			lf = next('\n', start)
+		}
+		if cr < start {
+			cr = next('\r', start)
+		}
+		end := lf
+		if cr < end {
+			end = cr
+		}
+		var pieces []piece
+		if end > start {
+			pieces = []piece{{false, start, end}}
+		}
+		s.lines.PushBack(pieceLine{pieces, -1}, 1)
+		if end == len(s.orig) {
+			break
+		}
+		le := LF
+		if s.orig[end] == '\r' {
+			le = CR
+			if end+1 < len(s.orig) && s.orig[end+1] == '\n' {
+				le = CRLF
+				end++
+			}
+		}
+		counts[le]++
+		start = end + 1
+	}
+	return
+}
+
+// remaining returns the number of bytes left to read from r, if r is a file
+// or an in-memory reader such as a *bytes.Reader, or 0 if it is unknown.
+func remaining(r io.Reader) int {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return r.Len()
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0
+		}
+		if offset, err := r.Seek(0, io.SeekCurrent); err == nil &&
+			offset < info.Size() {
+			return int(info.Size() - offset)
+		}
+	}
+	return 0
+}
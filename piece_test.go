@@ -0,0 +1,147 @@
+package edit
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// storeText returns the text of s with lines separated by "\n".
+func storeText(s lineStore) string {
+	lines := make([]string, 0, s.Len())
+	s.Walk(1, func(_ int, text []rune) bool {
+		lines = append(lines, string(text))
+		return true
+	})
+	return strings.Join(lines, "\n")
+}
+
+func TestPieceStore(t *testing.T) {
+	ps, ts := newPieceStore(), newTreeStore()
+	var counts [3]int
+	ps.Init()
+	n, err := ps.load(strings.NewReader("héllo\r\nwörld\n"), 0, &counts)
+	if want, got := int64(15), n; want != got || err != nil {
+		t.Errorf("load() == %v, %v; want %v, %v", got, err, want, nil)
+	}
+	if want, got := [3]int{1, 1, 0}, counts; want != got {
+		t.Errorf("load() counted %v; want %v", got, want)
+	}
+
+	// lengths of loaded lines are counted once, when first used
+	if want, got := -1, ps.lines.Get(1).Value.(pieceLine).length; want != got {
+		t.Errorf("length of loaded line == %v; want %v", got, want)
+	}
+	ps.LineLen(1)
+	if want, got := 5, ps.lines.Get(1).Value.(pieceLine).length; want != got {
+		t.Errorf("length of used line == %v; want %v", got, want)
+	}
+
+	ts.Init()
+	for _, line := range []string{"héllo", "wörld", ""} {
+		ts.PushBack([]rune(line))
+	}
+
+	// random edits
+	for i := 0; i < 200; i++ {
+		line := 1 + rand.Intn(ts.Len())
+		begin := Index{line, rand.Intn(ts.LineLen(line) + 1)}
+		if rand.Intn(2) == 0 {
+			lines := strings.Split([]string{"a", "ü", "b\nc",
+				"\n"}[rand.Intn(4)], "\n")
+			ps.Insert(begin, lines)
+			ts.Insert(begin, lines)
+		} else {
+			line = begin.Line + rand.Intn(ts.Len()-begin.Line+1)
+			end := Index{line, rand.Intn(ts.LineLen(line) + 1)}
+			if end.Less(begin) {
+				begin, end = end, begin
+			}
+			ps.Delete(begin, end)
+			ts.Delete(begin, end)
+		}
+		if want, got := storeText(ts), storeText(ps); want != got {
+			t.Fatalf("pieceStore text == %#v; want %#v", got, want)
+		}
+		for j := 1; j <= ts.Len(); j++ {
+			if want, got := ts.LineLen(j), ps.LineLen(j); want != got {
+				t.Fatalf("LineLen(%v) == %v; want %v", j, got, want)
+			}
+			if want, got := string(ts.Line(j)), string(ps.Line(j)); want != got {
+				t.Fatalf("Line(%v) == %#v; want %#v", j, got, want)
+			}
+		}
+	}
+
+	// runes split between reads
+	ps.Init()
+	n, err = ps.load(iotest.OneByteReader(strings.NewReader("é€\r😀")), 0,
+		&counts)
+	if want, got := int64(10), n; want != got || err != nil {
+		t.Errorf("load() == %v, %v; want %v, %v", got, err, want, nil)
+	}
+	if want, got := "é€\n😀", storeText(ps); want != got {
+		t.Errorf("pieceStore text == %#v; want %#v", got, want)
+	}
+
+	// invalid input
+	for _, c := range []struct {
+		input string
+		n     int64
+	}{
+		{"ok\n\xffno", 3},
+		{"ok\n\xe2\x82", 3}, // truncated at EOF
+	} {
+		ps.Init()
+		n, err = ps.load(iotest.HalfReader(strings.NewReader(c.input)), 0,
+			&counts)
+		if e, ok := err.(*DecodeError); !ok || e.Offset != c.n || n != c.n {
+			t.Errorf("load(%#q) == %v, %#v; want %v, offset %v", c.input, n,
+				err, c.n, c.n)
+		}
+		if want, got := "ok\n", storeText(ps); want != got {
+			t.Errorf("pieceStore text == %#v; want %#v", got, want)
+		}
+	}
+}
+
+func TestBufferPieceTableStorage(t *testing.T) {
+	b := NewBufferWithOptions(Options{Storage: PieceTableStorage})
+	src := "\xef\xbb\xbf" + testSource
+	b.ReadFrom(strings.NewReader(src))
+	if want, got := UTF8BOM, b.Encoding(); want != got {
+		t.Errorf("Encoding() == %v; want %v", got, want)
+	}
+	if want, got := testSource, b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %#v; want %#v", got, want)
+	}
+	if b.Modified() {
+		t.Error("Modified() returned true after ReadFrom")
+	}
+	lb := NewBuffer()
+	lb.ReadFrom(strings.NewReader(src))
+	for _, buf := range []*Buffer{b, lb} {
+		buf.Insert(Index{6, 0}, "\t// comment\n")
+		buf.Separate()
+		buf.Delete(Index{1, 3}, Index{3, 2})
+	}
+	if want, got := lb.Get(Index{1, 0}, lb.End()),
+		b.Get(Index{1, 0}, b.End()); want != got {
+		t.Errorf("Get() == %#v; want %#v", got, want)
+	}
+	b.Undo()
+	b.Undo()
+	var buf bytes.Buffer
+	b.WriteTo(&buf)
+	if want, got := src, buf.String(); want != got {
+		t.Errorf("WriteTo() wrote %#v; want %#v", got, want)
+	}
+
+	// invalid input
+	_, err := b.ReadFrom(strings.NewReader("\xef\xbb\xbfok\n\xe9"))
+	if e, ok := err.(*DecodeError); !ok || e.Offset != 6 || e.Encoding != UTF8BOM {
+		t.Errorf("ReadFrom() returned error %#v; want offset 6", err)
+	}
+}
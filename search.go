@@ -0,0 +1,343 @@
+package edit
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+)
+
+// runeReader reads the text of a lineStore between two indexes, with lines
+// separated by '\n'. Each rune is reported to have a size of 1, so that
+// offsets computed by a regexp.Regexp are in runes.
+type runeReader struct {
+	lines      lineStore
+	index, end Index
+	text       []rune // text of current line
+}
+
+func newRuneReader(lines lineStore, begin, end Index) *runeReader {
+	return &runeReader{lines, begin, end, lines.Line(begin.Line)}
+}
+
+func (r *runeReader) ReadRune() (ch rune, size int, err error) {
+	if !r.index.Less(r.end) {
+		return 0, 0, io.EOF
+	}
+	if r.index.Char < len(r.text) {
+		ch = r.text[r.index.Char]
+		r.index.Char++
+		return ch, 1, nil
+	}
+	r.index = Index{r.index.Line + 1, 0}
+	r.text = r.lines.Line(r.index.Line)
+	return '\n', 1, nil
+}
+
+// searcher finds matches of a regular expression in a Buffer. The expression
+// is wrapped so that it can be applied starting at any index with the
+// preceding rune available as context, so that assertions like ^ and \b
+// behave as they would if the whole text were searched. If the expression
+// prefers leftmost-longest matches, the longest match at the leftmost
+// position is found with a second, anchored expression.
+type searcher struct {
+	b        *Buffer
+	res      [2][2]*regexp.Regexp // indexed by [context][line-limited]
+	anchored [2]*regexp.Regexp    // indexed by [context]
+	original *regexp.Regexp
+	longest  bool // true if original prefers leftmost-longest matches
+}
+
+func newSearcher(b *Buffer, re *regexp.Regexp) *searcher {
+	return &searcher{b: b, original: re, longest: isLongest(re)}
+}
+
+// isLongest reports whether re prefers leftmost-longest matches, as after
+// regexp.Regexp.Longest or regexp.CompilePOSIX. The setting isn't exported,
+// so it is read from the unexported field; if the field is missing, re is
+// assumed to prefer leftmost-first matches.
+func isLongest(re *regexp.Regexp) bool {
+	f := reflect.ValueOf(re).Elem().FieldByName("longest")
+	return f.IsValid() && f.Kind() == reflect.Bool && f.Bool()
+}
+
+// regexp returns the wrapped regular expression for the given conditions.
+// If context is true, the expression expects to read one rune before the
+// search start. If lineLimited is true, matches must begin on the line where
+// the search starts.
+func (s *searcher) regexp(context, lineLimited bool) *regexp.Regexp {
+	c, l := 0, 0
+	if context {
+		c = 1
+	}
+	if lineLimited {
+		l = 1
+	}
+	if s.res[c][l] == nil {
+		pattern := `\A`
+		if context {
+			pattern += `(?s:.)`
+		}
+		if lineLimited {
+			pattern += `[^\n]*?`
+		} else {
+			pattern += `(?s:.*?)`
+		}
+		// The original expression compiled, so this will too
+		s.res[c][l] = regexp.MustCompile(pattern + "(" + s.original.String() +
+			")")
+	}
+	return s.res[c][l]
+}
+
+// anchoredRegexp returns the wrapped regular expression that finds the
+// leftmost-longest match beginning at the search start. If context is true,
+// the expression expects to read one rune before the search start.
+func (s *searcher) anchoredRegexp(context bool) *regexp.Regexp {
+	c := 0
+	if context {
+		c = 1
+	}
+	if s.anchored[c] == nil {
+		pattern := `\A`
+		if context {
+			pattern += `(?s:.)`
+		}
+		// The original expression compiled, so this will too
+		s.anchored[c] = regexp.MustCompile(pattern + "(" +
+			s.original.String() + ")")
+		s.anchored[c].Longest()
+	}
+	return s.anchored[c]
+}
+
+// find returns the leftmost match beginning at or after start, with text up
+// to end available to the expression. If lineLimited is true, only matches
+// beginning on start's line are found. The returned slice holds pairs of
+// indexes delimiting the match and its subexpressions, or is nil if there is
+// no match.
+func (s *searcher) find(start, end Index, lineLimited bool) []Index {
+	if end.Less(start) {
+		return nil
+	}
+	readerStart, context := start, start != Index{1, 0}
+	if context {
+		readerStart = s.b.shiftIndex(start, -1)
+	}
+	re := s.regexp(context, lineLimited)
+	loc := re.FindReaderSubmatchIndex(newRuneReader(s.b.lines, readerStart,
+		end))
+	if loc == nil {
+		return nil
+	} else if s.longest {
+		// The leftmost match begins where the leftmost-longest match does,
+		// but may be shorter.
+		start = s.b.shiftIndex(readerStart, loc[2])
+		readerStart, context = start, start != Index{1, 0}
+		if context {
+			readerStart = s.b.shiftIndex(start, -1)
+		}
+		loc = s.anchoredRegexp(context).FindReaderSubmatchIndex(
+			newRuneReader(s.b.lines, readerStart, end))
+	}
+	loc = loc[2:]
+	match := make([]Index, len(loc))
+	match[0] = s.b.shiftIndex(readerStart, loc[0])
+	for i := 1; i < len(loc); i++ {
+		if loc[i] >= 0 {
+			match[i] = s.b.shiftIndex(match[0], loc[i]-loc[0])
+		}
+	}
+	return match
+}
+
+// findAll returns all successive non-overlapping matches with text between
+// begin and end, as regexp.Regexp.FindAllSubmatchIndex does. If lineLimited
+// is true, only matches beginning on begin's line are found.
+func (s *searcher) findAll(begin, end Index, lineLimited bool) [][]Index {
+	var matches [][]Index
+	pos, prevEnd := begin, Index{}
+	for {
+		match := s.find(pos, end, lineLimited)
+		if match == nil {
+			break
+		}
+		if lineLimited && match[0].Line != begin.Line {
+			break
+		}
+		if match[0] == match[1] && match[0] == prevEnd {
+			// Ignore empty match abutting preceding match
+			if pos = s.b.shiftIndex(match[0], 1); pos == match[0] {
+				break
+			}
+			continue
+		}
+		matches = append(matches, match)
+		prevEnd = match[1]
+		if pos = match[1]; match[0] == match[1] {
+			if pos = s.b.shiftIndex(pos, 1); pos == match[1] {
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// findLast returns the last match beginning at or after lower and before
+// upper, with text up to end available to the expression.
+func (s *searcher) findLast(lower, upper, end Index) []Index {
+	for line := upper.Line; line >= lower.Line; line-- {
+		start := Index{line, 0}
+		if start.Less(lower) {
+			start = lower
+		}
+		var last []Index
+		for _, match := range s.findAll(start, end, true) {
+			if !match[0].Less(upper) {
+				break
+			}
+			last = match
+		}
+		if last != nil {
+			return last
+		}
+	}
+	return nil
+}
+
+// FindOptions modify the behavior of Find and FindBackward.
+type FindOptions struct {
+	// Begin and End delimit the text to search. The zero Index denotes the
+	// beginning or end of the buffer, respectively.
+	Begin, End Index
+
+	// If Wrap is true and no match is found before reaching one end of the
+	// searched text, searching continues from the other end.
+	Wrap bool
+}
+
+// bounds returns the clipped search bounds and start index for opts.
+func (b *Buffer) bounds(opts FindOptions, start Index) (Index, Index, Index) {
+	begin, end := b.clip(opts.Begin), b.end()
+	if opts.End != (Index{}) {
+		end = b.clip(opts.End)
+	}
+	start = b.clip(start)
+	if start.Less(begin) {
+		start = begin
+	} else if end.Less(start) {
+		start = end
+	}
+	return begin, end, start
+}
+
+// Find returns the first match of re in the buffer beginning at or after
+// start. The returned slice holds pairs of indexes delimiting the match and
+// the matches of each parenthesized subexpression, as with the index pairs
+// returned by regexp.Regexp.FindSubmatchIndex; subexpressions that did not
+// match are delimited by zero Indexes. If there is no match, nil is returned.
+// The text is read through an io.RuneReader, so it is never copied as a
+// whole. Text outside the searched range is not visible to re, except that
+// the rune preceding a match is used to evaluate assertions such as ^ and \b.
+// If re prefers leftmost-longest matches, so does the search.
+func (b *Buffer) Find(re *regexp.Regexp, start Index,
+	opts FindOptions) []Index {
+	<-b.unlock
+	begin, end, start := b.bounds(opts, start)
+	s := newSearcher(b, re)
+	match := s.find(start, end, false)
+	if match == nil && opts.Wrap {
+		if match = s.find(begin, end, false); match != nil &&
+			!match[0].Less(start) {
+			match = nil
+		}
+	}
+	b.unlock <- 1
+	return match
+}
+
+// FindAll returns all successive non-overlapping matches of re in the text
+// between begin and end, in the form returned by Find. As with
+// regexp.Regexp.FindAllSubmatchIndex, empty matches abutting a preceding
+// match are ignored.
+func (b *Buffer) FindAll(re *regexp.Regexp, begin, end Index) [][]Index {
+	<-b.unlock
+	begin, end = b.clip(begin), b.clip(end)
+	matches := newSearcher(b, re).findAll(begin, end, false)
+	b.unlock <- 1
+	return matches
+}
+
+// FindBackward returns the last match of re in the buffer beginning before
+// start, in the form returned by Find. Matches may extend past start.
+func (b *Buffer) FindBackward(re *regexp.Regexp, start Index,
+	opts FindOptions) []Index {
+	<-b.unlock
+	begin, end, start := b.bounds(opts, start)
+	s := newSearcher(b, re)
+	match := s.findLast(begin, start, end)
+	if match == nil && opts.Wrap {
+		match = s.findLast(start, end, end)
+	}
+	b.unlock <- 1
+	return match
+}
+
+// ReplaceAll replaces all matches of re in the text between begin and end
+// with template, in which $ signs are interpreted as in
+// regexp.Regexp.Expand, so that $1 denotes the text of the first
+// subexpression. Matches are found as with FindAll. The replacements form a
+// single sequence of operations on the undo stack, delimited by separators,
+// so that they are undone together. The number of replacements is returned.
+func (b *Buffer) ReplaceAll(re *regexp.Regexp, template string,
+	begin, end Index) int {
+	<-b.unlock
+	begin, end = b.clip(begin), b.clip(end)
+	matches := newSearcher(b, re).findAll(begin, end, false)
+	if len(matches) == 0 {
+		b.unlock <- 1
+		return 0
+	}
+	b.separate()
+
+	// Replace in reverse order so that the indexes of preceding matches
+	// remain valid.
+	offsets := make([]int, len(matches[0]))
+	for i := len(matches) - 1; i >= 0; i-- {
+		match := matches[i]
+		src := b.get(match[0], match[1])
+		for j := range match {
+			offsets[j] = -1
+			if match[j] != (Index{}) {
+				offsets[j] = len(b.get(match[0], match[j]))
+			}
+		}
+		text := normalizeEndings(string(re.ExpandString(nil, template, src,
+			offsets)))
+
+		// Insert the replacement before deleting the match, so that marks at
+		// the beginning of the match stay there.
+		if text != "" {
+			runes := []rune(text)
+			b.insert(match[1], text)
+			end := b.shiftIndex(match[1], len(runes))
+			b.versions++
+			b.undo.PushBack(bufferOp{true, match[1], end, runes, b.version,
+				b.versions})
+			b.version = b.versions
+			b.notify(InsertChange, match[1], end, runes, EditOrigin)
+		}
+		if match[0] != match[1] {
+			runes := []rune(src)
+			b.versions++
+			b.undo.PushBack(bufferOp{false, match[0], match[1], runes,
+				b.version, b.versions})
+			b.version = b.versions
+			b.delete(match[0], match[1])
+			b.notify(DeleteChange, match[0], match[1], runes, EditOrigin)
+		}
+	}
+	b.redo.Init()
+	b.separate()
+	b.unlock <- 1
+	return len(matches)
+}
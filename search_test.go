@@ -0,0 +1,230 @@
+package edit
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBufferFind(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "one two\nthree four\nfive")
+	re := regexp.MustCompile(`(t)(\w+)`)
+
+	// forward
+	want := []Index{{1, 4}, {1, 7}, {1, 4}, {1, 5}, {1, 5}, {1, 7}}
+	if got := b.Find(re, Index{1, 0}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+	want = []Index{{2, 0}, {2, 5}, {2, 0}, {2, 1}, {2, 1}, {2, 5}}
+	if got := b.Find(re, Index{1, 5}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+	if got := b.Find(re, Index{2, 1}, FindOptions{}); got != nil {
+		t.Errorf("Find returned %v; want nil", got)
+	}
+
+	// wraparound
+	want = []Index{{1, 4}, {1, 7}, {1, 4}, {1, 5}, {1, 5}, {1, 7}}
+	got := b.Find(re, Index{2, 1}, FindOptions{Wrap: true})
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+
+	// bounded range
+	got = b.Find(re, Index{1, 0}, FindOptions{End: Index{1, 6}})
+	want = []Index{{1, 4}, {1, 6}, {1, 4}, {1, 5}, {1, 5}, {1, 6}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+	if got := b.Find(re, Index{1, 0}, FindOptions{Begin: Index{2, 2}}); got != nil {
+		t.Errorf("Find returned %v; want nil", got)
+	}
+
+	// context for assertions
+	if got := b.Find(regexp.MustCompile(`(?m)^w`), Index{1, 5}, FindOptions{}); got != nil {
+		t.Errorf("Find returned %v; want nil", got)
+	}
+	if got := b.Find(regexp.MustCompile(`\bwo`), Index{1, 5}, FindOptions{}); got != nil {
+		t.Errorf("Find returned %v; want nil", got)
+	}
+	want = []Index{{2, 0}, {2, 1}}
+	got = b.Find(regexp.MustCompile(`(?m)^t`), Index{1, 1}, FindOptions{})
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+
+	// multi-line match and unmatched subexpression
+	want = []Index{{1, 6}, {2, 2}, {0, 0}, {0, 0}}
+	got = b.Find(regexp.MustCompile(`o\nth|(x)`), Index{1, 0}, FindOptions{})
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+}
+
+func TestBufferFindLongest(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "one two\nthree four\nfive")
+	re := regexp.MustCompile(`(t|tw|thr)(\w?)|o|o\nth`)
+	re.Longest()
+
+	want := []Index{{1, 4}, {1, 7}, {1, 4}, {1, 6}, {1, 6}, {1, 7}}
+	if got := b.Find(re, Index{1, 3}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+	want = []Index{{1, 6}, {2, 2}, {0, 0}, {0, 0}, {0, 0}, {0, 0}}
+	if got := b.Find(re, Index{1, 5}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("Find returned %v; want %v", got, want)
+	}
+	want = []Index{{2, 0}, {2, 4}, {2, 0}, {2, 3}, {2, 3}, {2, 4}}
+	if got := b.FindBackward(re, Index{2, 1}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+	wantAll := [][]Index{{{1, 0}, {1, 1}}, {{1, 6}, {2, 2}}, {{2, 7}, {2, 8}}}
+	got := b.FindAll(regexp.MustCompilePOSIX(`o|o\nth`), Index{1, 0}, b.End())
+	if !reflect.DeepEqual(wantAll, got) {
+		t.Errorf("FindAll returned %v; want %v", got, wantAll)
+	}
+}
+
+func TestBufferFindBackward(t *testing.T) {
+	b := NewBuffer()
+	b.Insert(b.End(), "one two\nthree four\nfive")
+	re := regexp.MustCompile(`t\w+`)
+
+	want := []Index{{2, 0}, {2, 5}}
+	if got := b.FindBackward(re, b.End(), FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+	want = []Index{{1, 4}, {1, 7}}
+	if got := b.FindBackward(re, Index{2, 0}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+	want = []Index{{1, 4}, {1, 7}} // match extends past start
+	if got := b.FindBackward(re, Index{1, 5}, FindOptions{}); !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+	if got := b.FindBackward(re, Index{1, 4}, FindOptions{}); got != nil {
+		t.Errorf("FindBackward returned %v; want nil", got)
+	}
+	want = []Index{{2, 0}, {2, 5}}
+	got := b.FindBackward(re, Index{1, 4}, FindOptions{Wrap: true})
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+	want = []Index{{1, 4}, {1, 7}}
+	got = b.FindBackward(re, b.End(), FindOptions{End: Index{2, 0}})
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("FindBackward returned %v; want %v", got, want)
+	}
+}
+
+func TestBufferFindAll(t *testing.T) {
+	text := "\tfoo bar\n\t\tbaz\n\nqux  foo\n"
+	patterns := []string{`(?m)^\t`, `\bba`, `o*`, `(?m)$`, `\s+`, `(?s)a.*?o`,
+		`(b)?(a)`}
+	b := NewBuffer()
+	b.Insert(b.End(), text)
+	for _, p := range patterns {
+		re := regexp.MustCompile(p)
+		var want [][]Index
+		for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+			match := make([]Index, len(loc))
+			for i, offset := range loc {
+				if offset >= 0 {
+					match[i] = b.shiftIndex(Index{1, 0},
+						len([]rune(text[:offset])))
+				}
+			}
+			want = append(want, match)
+		}
+		got := b.FindAll(re, Index{1, 0}, b.End())
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("FindAll(%#q) returned %v; want %v", p, got, want)
+		}
+	}
+
+	// bounded range
+	got := b.FindAll(regexp.MustCompile(`foo`), Index{1, 2}, b.End())
+	want := [][]Index{{{4, 5}, {4, 8}}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("FindAll returned %v; want %v", got, want)
+	}
+}
+
+func TestBufferFindPieceTable(t *testing.T) {
+	text := strings.Repeat("alphaé beta\ngamma\n", 3)
+	b := NewBufferWithOptions(Options{Storage: PieceTableStorage})
+	b.ReadFrom(strings.NewReader(text))
+	got := b.FindAll(regexp.MustCompile(`é b`), Index{1, 0}, b.End())
+	want := [][]Index{{{1, 5}, {1, 8}}, {{3, 5}, {3, 8}}, {{5, 5}, {5, 8}}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("FindAll returned %v; want %v", got, want)
+	}
+}
+
+// Current benchmark: 5 ms/op
+func BenchmarkLargeBufferFind(b *testing.B) {
+	buf := largeBuffer()
+	re := regexp.MustCompile(`not present`)
+	start := Index{benchLargeBufLines - 1000, 0}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Find(re, start, FindOptions{})
+	}
+}
+
+func TestBufferReplaceAll(t *testing.T) {
+	text := "foo = bar\n\tbaz = quux\n"
+	b := NewBuffer()
+	b.Insert(b.End(), text)
+	b.Mark(Index{2, 8}, 0)
+	b.Mark(Index{3, 0}, 1)
+	b.Mark(Index{1, 0}, 2)
+	b.Separate()
+
+	re := regexp.MustCompile(`(\w+) = (\w+)`)
+	if n := b.ReplaceAll(re, "$2\n= ${1}x", Index{1, 0}, b.End()); n != 2 {
+		t.Errorf("ReplaceAll returned %v; want 2", n)
+	}
+	want, got := "bar\n= foox\n\tquux\n= bazx\n", b.Get(Index{1, 0}, b.End())
+	if want != got {
+		t.Errorf("Get returned %#v; want %#v", got, want)
+	}
+	// marks at the beginning of or inside a match go to the beginning
+	wantMarks := []Index{{3, 1}, {5, 0}, {1, 0}}
+	for id, want := range wantMarks {
+		if got := b.IndexFromMark(id); want != got {
+			t.Errorf("IndexFromMark(%v) returned %v; want %v", id, got, want)
+		}
+	}
+
+	// further edits are not merged with the replacements
+	b.Insert(b.End(), "!")
+	b.Undo()
+	b.Undo()
+	want, got = text, b.Get(Index{1, 0}, b.End())
+	if want != got {
+		t.Errorf("Get returned %#v; want %#v", got, want)
+	}
+	b.Redo()
+	want, got = "bar\n= foox\n\tquux\n= bazx\n", b.Get(Index{1, 0}, b.End())
+	if want != got {
+		t.Errorf("Get returned %#v; want %#v", got, want)
+	}
+
+	// empty matches and bounded range
+	if n := b.ReplaceAll(regexp.MustCompile(`(?m)^`), "> ", Index{2, 0},
+		Index{4, 0}); n != 3 {
+		t.Errorf("ReplaceAll returned %v; want 3", n)
+	}
+	want, got = "bar\n> = foox\n> \tquux\n> = bazx\n", b.Get(Index{1, 0}, b.End())
+	if want != got {
+		t.Errorf("Get returned %#v; want %#v", got, want)
+	}
+	if n := b.ReplaceAll(regexp.MustCompile(`none`), "", Index{1, 0},
+		b.End()); n != 0 {
+		t.Errorf("ReplaceAll returned %v; want 0", n)
+	}
+}
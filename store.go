@@ -0,0 +1,106 @@
+package edit
+
+// lineStore is a storage engine for the text of a Buffer. Lines are numbered
+// from 1, and a store always contains at least one line.
+type lineStore interface {
+	// Len returns the number of lines in the store.
+	Len() int
+
+	// Line returns the text of line n. The returned slice must not be
+	// modified.
+	Line(n int) []rune
+
+	// LineLen returns the length of line n in runes.
+	LineLen(n int) int
+
+	// Walk calls fn with the text of each line in order, beginning with line
+	// n, until fn returns false. The text passed to fn must not be modified,
+	// and is only valid until fn returns.
+	Walk(n int, fn func(n int, text []rune) bool)
+
+	// Insert inserts lines at index. The first element of lines is inserted
+	// into the line at index, and each following element begins a new line.
+	Insert(index Index, lines []string)
+
+	// Delete removes the text between begin and end.
+	Delete(begin, end Index)
+
+	// Init clears the store, leaving no lines.
+	Init()
+
+	// PushBack appends a line containing text to the store.
+	PushBack(text []rune)
+}
+
+type lineInfo struct {
+	text []rune
+}
+
+// treeStore is a lineStore that keeps each line as a separate slice of runes.
+type treeStore struct {
+	lines *tree // tree of lineInfos
+}
+
+func newTreeStore() *treeStore {
+	s := &treeStore{newTree()}
+	s.lines.PushBack(lineInfo{[]rune("")}, 1)
+	return s
+}
+
+func (s *treeStore) Len() int {
+	return s.lines.Len()
+}
+
+func (s *treeStore) Line(n int) []rune {
+	return s.lines.Get(n).Value.(lineInfo).text
+}
+
+func (s *treeStore) LineLen(n int) int {
+	return len(s.Line(n))
+}
+
+func (s *treeStore) Walk(n int, fn func(n int, text []rune) bool) {
+	s.lines.Walk(n, func(i int, elem *node) bool {
+		return fn(i, elem.Value.(lineInfo).text)
+	})
+}
+
+func (s *treeStore) Insert(index Index, lines []string) {
+	lineText := s.Line(index.Line)
+	if len(lines) == 1 {
+		s.lines.Set(index.Line, lineInfo{[]rune(string(lineText[:index.Char]) +
+			lines[0] + string(lineText[index.Char:]))}, 1)
+		return
+	}
+	tail := string(lineText[index.Char:])
+	for i, line := range lines {
+		if i == 0 {
+			s.lines.Set(index.Line, lineInfo{append(lineText[:index.Char:index.Char],
+				[]rune(line)...)}, 1)
+			continue
+		} else if i == len(lines)-1 {
+			line += tail
+		}
+		s.lines.Insert(index.Line+i, lineInfo{[]rune(line)}, 1)
+	}
+}
+
+func (s *treeStore) Delete(begin, end Index) {
+	text := s.Line(begin.Line)
+	if end.Line > begin.Line {
+		endText := s.Line(end.Line)
+		s.lines.Remove(begin.Line+1, end.Line)
+		text = append(text[:begin.Char:begin.Char], endText[end.Char:]...)
+	} else {
+		text = append(text[:begin.Char:begin.Char], text[end.Char:]...)
+	}
+	s.lines.Set(begin.Line, lineInfo{text}, 1)
+}
+
+func (s *treeStore) Init() {
+	s.lines.Init()
+}
+
+func (s *treeStore) PushBack(text []rune) {
+	s.lines.PushBack(lineInfo{text}, 1)
+}
@@ -0,0 +1,751 @@
+package edit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ReadSublimeSyntax reads a Sublime Text syntax definition (a
+// .sublime-syntax file) from r and converts it to a Language, in the manner
+// of ReadTextMate.
+//
+// The definition's file_extensions and first_line_match determine the
+// Language's Files and FirstLine, and its scope names become tag names.
+// Variables are expanded in patterns. Of its rules, "match" rules with
+// "scope" and "captures", "match" rules that push a context, and "include"
+// of contexts are supported; the prototype context is included before main.
+// A pushed context becomes a region that ends at the first rule of the
+// context that pops it, tagged with the context's meta_scope or
+// meta_content_scope, or else with the scope of the pushing rule. Other
+// constructs are reported as by ReadTextMate. The YAML of the definition may
+// use block and flow styles, but not anchors, aliases, or tags.
+func ReadSublimeSyntax(r io.Reader) (*Language, error) {
+	def, err := readYAML(r)
+	if err != nil {
+		return nil, &DefinitionError{Err: err.Error()}
+	}
+	root, ok := def.(map[string]interface{})
+	if !ok {
+		return nil, &DefinitionError{Err: "syntax is not a mapping"}
+	}
+
+	c := &tmConverter{l: &Language{}, included: make(map[string]bool),
+		variables: make(map[string]string)}
+	c.l.Name, _ = root["name"].(string)
+	if c.l.Name == "" {
+		c.l.Name, _ = root["scope"].(string)
+	}
+	extensions, _ := root["file_extensions"].([]interface{})
+	for _, v := range extensions {
+		if s, ok := v.(string); ok {
+			c.l.Files = append(c.l.Files, "*."+s, s)
+		}
+	}
+	variables, _ := root["variables"].(map[string]interface{})
+	for name, v := range variables {
+		if s, ok := v.(string); ok {
+			c.variables[name] = s
+		} else {
+			c.error("variables."+name, "not a string")
+		}
+	}
+	if s, ok := root["first_line_match"].(string); ok {
+		if s, ok = c.pattern(s, "first_line_match"); ok {
+			c.l.FirstLine = append(c.l.FirstLine, regexp.MustCompile(s))
+		}
+	}
+	if _, ok := root["extends"]; ok {
+		c.error("extends", "not supported")
+	}
+	c.repository, _ = root["contexts"].(map[string]interface{})
+	if prototype, ok := c.repository["prototype"]; ok {
+		c.context(prototype, "contexts.prototype")
+	}
+	if main, ok := c.repository["main"]; ok {
+		c.context(main, "contexts.main")
+	} else {
+		c.error("contexts.main", "missing")
+	}
+	if len(c.errs) > 0 {
+		return c.l, c.errs
+	}
+	return c.l, nil
+}
+
+// variableRef matches a reference to a variable in a pattern of a Sublime
+// Text syntax.
+var variableRef = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// pattern returns s, a pattern of a Sublime Text syntax, with references to
+// variables expanded. If the variables can't be expanded or the result is not
+// a valid Go regular expression, the error is reported and false is returned.
+func (c *tmConverter) pattern(s, path string) (string, bool) {
+	expanding := make(map[string]bool) // to detect recursive variables
+	var err error
+	var expand func(s string) string
+	expand = func(s string) string {
+		return variableRef.ReplaceAllStringFunc(s, func(ref string) string {
+			name := ref[2 : len(ref)-2]
+			value, ok := c.variables[name]
+			switch {
+			case err != nil:
+			case !ok:
+				err = fmt.Errorf("undefined variable %#v", name)
+			case expanding[name]:
+				err = fmt.Errorf("recursive variable %#v", name)
+			default:
+				expanding[name] = true
+				value = expand(value)
+				delete(expanding, name)
+				return value
+			}
+			return ""
+		})
+	}
+	s = expand(s)
+	if err == nil {
+		_, err = regexp.Compile(s)
+	}
+	if err != nil {
+		c.error(path, err.Error())
+		return "", false
+	}
+	return s, true
+}
+
+// context converts the rules of a Sublime Text context.
+func (c *tmConverter) context(v interface{}, path string) {
+	rules, ok := v.([]interface{})
+	if !ok {
+		c.error(path, "not a list")
+		return
+	}
+	for i, rule := range rules {
+		c.sublimeRule(rule, fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+// isMeta reports whether rule is a meta rule of a Sublime Text context,
+// which sets the context's scopes or options rather than matching text.
+func isMeta(rule map[string]interface{}) bool {
+	for _, key := range []string{"meta_scope", "meta_content_scope",
+		"meta_include_prototype", "clear_scopes", "meta_prepend",
+		"meta_append"} {
+		if _, ok := rule[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sublimeRule converts a rule of a Sublime Text context.
+func (c *tmConverter) sublimeRule(v interface{}, path string) {
+	rule, ok := v.(map[string]interface{})
+	if !ok {
+		c.error(path, "not a mapping")
+		return
+	}
+	match, _ := rule["match"].(string)
+	include, _ := rule["include"].(string)
+
+	switch {
+	case include != "":
+		c.sublimeInclude(include, path)
+	case isMeta(rule):
+		c.error(path, "meta rules are only supported in pushed contexts; "+
+			"ignored")
+	case match != "":
+		for _, key := range []string{"set", "embed", "branch", "fail"} {
+			if _, ok := rule[key]; ok {
+				c.error(path+"."+key, "not supported")
+				return
+			}
+		}
+		if _, ok := rule["pop"]; ok {
+			c.error(path+".pop", "only supported in pushed contexts; ignored")
+		}
+		// Check the pattern first so that tags of an omitted rule aren't
+		// defined
+		match, ok := c.pattern(match, path+".match")
+		if !ok {
+			return
+		}
+		if push, ok := rule["push"]; ok {
+			c.push(match, rule, push, path)
+			return
+		}
+		scope, _ := rule["scope"].(string)
+		captures, tag := c.captures(rule["captures"], path+".captures")
+		if tag == noneTag {
+			tag = c.l.tag(scope)
+		}
+		r, _ := NewCaptureRule(match, tag, captures...)
+		c.l.Rules = append(c.l.Rules, r)
+	default:
+		c.error(path, "missing match or include")
+	}
+}
+
+// push converts a rule that matches begin and pushes a context, v, to a
+// region rule.
+func (c *tmConverter) push(begin string, rule map[string]interface{},
+	v interface{}, path string) {
+	ctxPath := path + ".push"
+	if name, ok := v.(string); ok {
+		if v, ok = c.repository[name]; !ok {
+			c.error(ctxPath, fmt.Sprintf("no context %#v", name))
+			return
+		}
+		ctxPath = "contexts." + name
+	}
+	rules, ok := v.([]interface{})
+	if !ok {
+		c.error(ctxPath, "not a list")
+		return
+	} else if len(rules) > 0 {
+		if _, ok := rules[0].(string); ok {
+			c.error(ctxPath, "pushing multiple contexts is not supported")
+			return
+		}
+	}
+
+	name, end := "", ""
+	for i, v := range rules {
+		rulePath := fmt.Sprintf("%s[%d]", ctxPath, i)
+		r, _ := v.(map[string]interface{})
+		switch {
+		case isMeta(r):
+			for _, key := range []string{"meta_scope", "meta_content_scope"} {
+				if s, ok := r[key].(string); ok && name == "" {
+					name = s
+				}
+			}
+			for _, key := range []string{"clear_scopes", "meta_prepend",
+				"meta_append"} {
+				if _, ok := r[key]; ok {
+					c.error(rulePath+"."+key, "not supported; ignored")
+				}
+			}
+		case end == "" && (r["pop"] == "true" || r["pop"] == "1"):
+			match, _ := r["match"].(string)
+			if end, ok = c.pattern(match, rulePath+".match"); !ok {
+				return
+			}
+		default:
+			c.error(rulePath, "rules other than meta rules and the first "+
+				"pop are not supported in pushed contexts; ignored")
+		}
+	}
+	if end == "" {
+		c.error(ctxPath, "no rule pops the context")
+		return
+	}
+	for _, key := range []string{"scope", "captures"} {
+		if _, ok := rule[key]; ok && (name != "" || key == "captures") {
+			c.error(path+"."+key, "not supported for rules that push a "+
+				"context with a meta scope; ignored")
+		}
+	}
+	if name == "" {
+		name, _ = rule["scope"].(string)
+	}
+	r, _ := NewRegionRule(begin, end, c.l.tag(name))
+	c.l.Rules = append(c.l.Rules, r)
+}
+
+// sublimeInclude converts the rules of an included Sublime Text context.
+func (c *tmConverter) sublimeInclude(name, path string) {
+	ctx, ok := c.repository[name]
+	switch {
+	case strings.HasPrefix(name, "scope:") || strings.Contains(name, "."):
+		c.error(path+".include", fmt.Sprintf(
+			"including %#v is not supported; only contexts of the same "+
+				"syntax can be included", name))
+	case !ok:
+		c.error(path+".include", fmt.Sprintf("no context %#v", name))
+	case c.included[name]:
+		c.error(path+".include", fmt.Sprintf(
+			"recursive include of %#v is not supported", name))
+	default:
+		c.included[name] = true
+		c.context(ctx, "contexts."+name)
+		delete(c.included, name)
+	}
+}
+
+// yamlParser holds the state of reading a YAML document.
+type yamlParser struct {
+	lines []string
+	i     int // next line to read
+	line  int // line being read, for errors
+}
+
+// errUnterminated is returned when a quoted scalar or flow collection
+// continues past the end of the text being read.
+var errUnterminated = errors.New("unterminated scalar or collection")
+
+// readYAML reads the first document of a YAML stream from r. Mappings,
+// sequences, and scalars are returned as map[string]interface{},
+// []interface{}, and string values; null values are empty strings. Anchors,
+// aliases, tags, and complex keys are not supported.
+func readYAML(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+
+	// Skip directives and the document start marker, and ignore anything
+	// after the end of the document
+	for ; p.i < len(p.lines); p.i++ {
+		if line := p.lines[p.i]; !strings.HasPrefix(line, "%") &&
+			!isComment(line) {
+			if line == "---" {
+				p.i++
+			} else if strings.HasPrefix(line, "--- ") {
+				p.lines[p.i] = line[4:]
+			}
+			break
+		}
+	}
+	for j := p.i; j < len(p.lines); j++ {
+		if line := p.lines[j]; line == "..." || line == "---" ||
+			strings.HasPrefix(line, "--- ") {
+			p.lines = p.lines[:j]
+			break
+		}
+	}
+
+	v, err := p.block(0)
+	if err == nil {
+		if _, _, ok := p.peek(); ok {
+			err = p.errorf("bad indentation")
+		}
+	}
+	return v, err
+}
+
+func (p *yamlParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line+1, fmt.Sprintf(format, a...))
+}
+
+// isComment reports whether line is blank or only a comment.
+func isComment(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	return line == "" || line[0] == '#'
+}
+
+// isItem reports whether text, a line without its indentation, begins an
+// entry of a block sequence.
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ") ||
+		strings.HasPrefix(text, "-\t")
+}
+
+// stripComment returns text, the rest of a line, without a trailing comment
+// and white space.
+func stripComment(text string) string {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t') {
+			text = text[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// peek skips blank and comment lines, and returns the indentation and text
+// of the next line, if there is one.
+func (p *yamlParser) peek() (indent int, text string, ok bool) {
+	for ; p.i < len(p.lines); p.i++ {
+		if line := p.lines[p.i]; !isComment(line) {
+			text = strings.TrimLeft(line, " ")
+			p.line = p.i
+			return len(line) - len(text), strings.TrimRight(text, " \t"),
+				true
+		}
+	}
+	return 0, "", false
+}
+
+// block reads a node beginning on the next line that is indented by at least
+// min spaces, or returns an empty scalar if there is no such line.
+func (p *yamlParser) block(min int) (interface{}, error) {
+	indent, text, ok := p.peek()
+	switch {
+	case ok && text[0] == '\t':
+		return nil, p.errorf("tab in indentation")
+	case !ok || indent < min:
+		return "", nil
+	case isItem(text):
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitKey(text); ok {
+		return p.mapping(indent)
+	}
+	p.i++
+	return p.value(text, min-1)
+}
+
+// sequence reads a block sequence whose entries are indented by indent
+// spaces.
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for {
+		n, text, ok := p.peek()
+		if !ok || n < indent || n == indent && !isItem(text) {
+			return seq, nil
+		} else if n > indent || !isItem(text) {
+			return nil, p.errorf("bad indentation")
+		}
+		// Read the rest of the line as if the indicator were indentation
+		rest := strings.TrimLeft(text[1:], " \t")
+		if rest == "" || rest[0] == '#' {
+			p.i++
+		} else {
+			p.lines[p.i] = strings.Repeat(" ", indent+len(text)-len(rest)) +
+				rest
+		}
+		v, err := p.block(indent + 1)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+}
+
+// mapping reads a block mapping whose keys are indented by indent spaces.
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		n, text, ok := p.peek()
+		if ok && text[0] == '\t' {
+			return nil, p.errorf("tab in indentation")
+		} else if !ok || n < indent {
+			return m, nil
+		} else if n > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		key, rest, ok := splitKey(text)
+		if !ok {
+			return nil, p.errorf("expected a mapping key")
+		} else if _, ok := m[key]; ok {
+			return nil, p.errorf("duplicate key %#v", key)
+		}
+		p.i++
+		var v interface{}
+		var err error
+		if rest = strings.TrimLeft(rest, " \t"); rest != "" && rest[0] != '#' {
+			v, err = p.value(rest, indent)
+		} else if n, text, ok := p.peek(); ok && n == indent && isItem(text) {
+			v, err = p.sequence(indent) // sequences may be "indented" by 0
+		} else {
+			v, err = p.block(indent + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// splitKey splits text, a line without its indentation, into the key of a
+// block mapping entry and the rest of the line after the colon. If text is
+// not a mapping entry, ok is false.
+func splitKey(text string) (key, rest string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		v, rest, err := flowNode(text)
+		rest = strings.TrimLeft(rest, " \t")
+		if err != nil || !strings.HasPrefix(rest, ":") ||
+			len(rest) > 1 && rest[1] != ' ' && rest[1] != '\t' {
+			return "", "", false
+		}
+		return v.(string), rest[1:], true
+	} else if strings.ContainsRune("[{#&*!|>%@`?", rune(text[0])) {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' ||
+			text[i+1] == '\t'):
+			return strings.TrimRight(text[:i], " \t"), text[i+1:], true
+		case text[i] == '#' && (text[i-1] == ' ' || text[i-1] == '\t'):
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// value reads a node that begins with text, the rest of the current line,
+// in a node indented by indent spaces. Plain scalars continue on following
+// lines that are indented by more than indent spaces.
+func (p *yamlParser) value(text string, indent int) (interface{}, error) {
+	switch text[0] {
+	case '"', '\'', '[', '{':
+		for {
+			v, rest, err := flowNode(text)
+			if err == errUnterminated && p.i < len(p.lines) {
+				text += " " + strings.TrimSpace(p.lines[p.i])
+				p.i++
+				continue
+			} else if err != nil {
+				return nil, p.errorf("%v", err)
+			} else if rest = strings.TrimLeft(rest, " \t"); rest != "" &&
+				rest[0] != '#' {
+				return nil, p.errorf("unexpected %#v", rest)
+			}
+			return v, nil
+		}
+	case '|', '>':
+		return p.blockScalar(text, indent)
+	case '&', '*', '!':
+		return nil, p.errorf("anchors, aliases, and tags are not supported")
+	case '@', '`', '%':
+		return nil, p.errorf("reserved character %#v", text[:1])
+	}
+	s := stripComment(text)
+	for {
+		n, next, ok := p.peek()
+		if !ok || n <= indent || strings.Contains(text, " #") {
+			return s, nil
+		} else if _, _, ok := splitKey(next); ok || isItem(next) {
+			return nil, p.errorf("bad indentation")
+		}
+		s += " " + stripComment(next)
+		text = next
+		p.i++
+	}
+}
+
+// blockScalar reads a literal or folded block scalar with header in a node
+// indented by indent spaces.
+func (p *yamlParser) blockScalar(header string, indent int) (interface{},
+	error) {
+	header = stripComment(header)
+	chomp, n := byte(0), 0 // chomping and indentation indicators
+	for i := 1; i < len(header); i++ {
+		switch ch := header[i]; {
+		case (ch == '-' || ch == '+') && chomp == 0:
+			chomp = ch
+		case ch >= '1' && ch <= '9' && n == 0:
+			n = int(ch - '0')
+		default:
+			return nil, p.errorf("invalid block scalar header %#v", header)
+		}
+	}
+	if indent < 0 {
+		indent = 0
+	}
+	blockIndent := 0
+	if n > 0 {
+		blockIndent = indent + n
+	}
+
+	var lines []string
+	for ; p.i < len(p.lines); p.i++ {
+		line := strings.TrimRight(p.lines[p.i], " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(text)
+		if blockIndent == 0 {
+			if n <= indent {
+				break
+			}
+			blockIndent = n
+		}
+		if n < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	k := len(lines)
+	for k > 0 && lines[k-1] == "" {
+		k--
+	}
+	trailing := len(lines) - k
+	lines = lines[:k]
+
+	var s string
+	if header[0] == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		// Fold line breaks between lines that aren't more indented into
+		// spaces; empty lines are line breaks
+		breaks := 0
+		for i, line := range lines {
+			switch {
+			case line == "":
+				breaks++
+				continue
+			case i == 0 || breaks > 0:
+				s += strings.Repeat("\n", breaks)
+			case line[0] == ' ' || strings.HasPrefix(lines[i-1], " "):
+				s += "\n"
+			default:
+				s += " "
+			}
+			s += line
+			breaks = 0
+		}
+	}
+	if len(lines) > 0 && chomp != '-' {
+		s += "\n"
+	}
+	if chomp == '+' {
+		s += strings.Repeat("\n", trailing)
+	}
+	return s, nil
+}
+
+// flowNode reads a quoted scalar, flow collection, or plain scalar in a flow
+// collection at the beginning of s, and returns it with the rest of s.
+func flowNode(s string) (interface{}, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return nil, s, errUnterminated
+	}
+	switch s[0] {
+	case '\'':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+			} else if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+			} else {
+				return b.String(), s[i+1:], nil
+			}
+		}
+		return nil, "", errUnterminated
+	case '"':
+		return doubleQuoted(s)
+	case '[':
+		seq := []interface{}{}
+		for s = s[1:]; ; {
+			if s = strings.TrimLeft(s, " \t"); s == "" {
+				return nil, s, errUnterminated
+			} else if s[0] == ']' {
+				return seq, s[1:], nil
+			}
+			v, rest, err := flowNode(s)
+			if err != nil {
+				return nil, rest, err
+			}
+			seq = append(seq, v)
+			if s, err = flowNext(rest, ']'); err != nil {
+				return nil, s, err
+			}
+		}
+	case '{':
+		m := make(map[string]interface{})
+		for s = s[1:]; ; {
+			if s = strings.TrimLeft(s, " \t"); s == "" {
+				return nil, s, errUnterminated
+			} else if s[0] == '}' {
+				return m, s[1:], nil
+			}
+			k, rest, err := flowNode(s)
+			if err != nil {
+				return nil, rest, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, rest, errors.New("complex keys are not supported")
+			}
+			var v interface{} = ""
+			if rest = strings.TrimLeft(rest, " \t"); strings.HasPrefix(rest,
+				":") {
+				if v, rest, err = flowNode(rest[1:]); err != nil {
+					return nil, rest, err
+				}
+			}
+			m[key] = v
+			if s, err = flowNext(rest, '}'); err != nil {
+				return nil, s, err
+			}
+		}
+	case ']', '}', ',':
+		return "", s, nil
+	case '&', '*', '!':
+		return nil, s, errors.New("anchors, aliases, and tags are not " +
+			"supported")
+	}
+	i := 0
+	for ; i < len(s); i++ {
+		if strings.IndexByte(",[]{}", s[i]) >= 0 ||
+			s[i] == ':' && (i+1 == len(s) || strings.IndexByte(" \t,]}",
+				s[i+1]) >= 0) ||
+			s[i] == '#' && i > 0 && (s[i-1] == ' ' || s[i-1] == '\t') {
+			break
+		}
+	}
+	return strings.TrimSpace(s[:i]), s[i:], nil
+}
+
+// flowNext returns s, the text after an entry of a flow collection that ends
+// with end, after the comma following the entry. The end of the collection
+// isn't consumed.
+func flowNext(s string, end byte) (string, error) {
+	switch s = strings.TrimLeft(s, " \t"); {
+	case s == "":
+		return s, errUnterminated
+	case s[0] == ',':
+		return s[1:], nil
+	case s[0] == end:
+		return s, nil
+	}
+	return s, fmt.Errorf("expected \",\" or %#v before %#v", string(end), s)
+}
+
+// yamlEscapes maps the escape sequences of double-quoted scalars, other than
+// those for code points, to the runes they denote.
+var yamlEscapes = map[byte]rune{'0': 0, 'a': '\a', 'b': '\b', 't': '\t',
+	'\t': '\t', 'n': '\n', 'v': '\v', 'f': '\f', 'r': '\r', 'e': 0x1b, ' ': ' ',
+	'"': '"', '/': '/', '\\': '\\', 'N': 0x85, '_': 0xa0, 'L': 0x2028,
+	'P': 0x2029}
+
+// doubleQuoted reads a double-quoted scalar at the beginning of s, and
+// returns it with the rest of s.
+func doubleQuoted(s string) (interface{}, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i++; i == len(s) {
+				return nil, "", errUnterminated
+			}
+			if r, ok := yamlEscapes[s[i]]; ok {
+				b.WriteRune(r)
+				continue
+			}
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if n == 0 || i+n >= len(s) {
+				return nil, "", fmt.Errorf("invalid escape %#v", s[i-1:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return nil, "", fmt.Errorf("invalid escape %#v",
+					s[i-1:i+1+n])
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return nil, "", errUnterminated
+}
@@ -0,0 +1,182 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSublimeSyntax = `%YAML 1.2
+---
+# A syntax for testing
+name: Test
+scope: source.test
+file_extensions: [tst]
+first_line_match: ^#!.*{{name}}
+variables:
+  name: test
+  ident: '[a-z]\w*'
+  call: '({{ident}})\('
+contexts:
+  prototype:
+    - include: comments
+  main:
+    - match: '\b(func) ({{ident}})'
+      captures:
+        1: keyword.other
+        2: entity.name.function
+    - match: \bvar\b
+      scope: keyword.other
+    - match: '"'
+      scope: punctuation.definition.string
+      push: string
+    - match: a(?=b)
+      scope: invalid
+    - include: scope:source.other
+    - include: missing
+    - include: recursive
+    - match: x
+      set: string
+  string:
+    - meta_scope: string.quoted
+    - match: \\.
+      scope: constant.escape
+    - match: '"'
+      pop: true
+  comments:
+    - match: /\*
+      push:
+        - meta_scope: comment.block
+        - match: \*/
+          pop: true
+    - match: |-
+        //.*
+      scope: comment.line
+  recursive:
+    - include: recursive
+`
+
+func TestReadSublimeSyntax(t *testing.T) {
+	l, err := ReadSublimeSyntax(strings.NewReader(testSublimeSyntax))
+	if l == nil {
+		t.Fatalf("ReadSublimeSyntax returned nil Language; error: %v", err)
+	}
+	errs, ok := err.(DefinitionErrors)
+	if !ok {
+		t.Fatalf("ReadSublimeSyntax returned error %#v; want DefinitionErrors",
+			err)
+	}
+	wantErrs := []string{
+		"contexts.string[1]: rules other than meta rules and the first " +
+			"pop are not supported in pushed contexts; ignored",
+		"contexts.main[2].scope: not supported for rules that push a " +
+			"context with a meta scope; ignored",
+		"contexts.main[3].match: error parsing regexp: invalid or " +
+			"unsupported Perl syntax: `(?=`",
+		`contexts.main[4].include: including "scope:source.other" is not ` +
+			"supported; only contexts of the same syntax can be included",
+		`contexts.main[5].include: no context "missing"`,
+		`contexts.recursive[0].include: recursive include of "recursive" ` +
+			"is not supported",
+		"contexts.main[7].set: not supported",
+	}
+	if len(errs) != len(wantErrs) {
+		t.Errorf("ReadSublimeSyntax returned %v errors; want %v", len(errs),
+			len(wantErrs))
+	}
+	for i := 0; i < len(errs) && i < len(wantErrs); i++ {
+		want := "edit: syntax definition: " + wantErrs[i]
+		if got := errs[i].Error(); want != got {
+			t.Errorf("ReadSublimeSyntax returned error %#q; want %#q", got,
+				want)
+		}
+	}
+
+	if want, got := "Test", l.Name; want != got {
+		t.Errorf("Name == %#v; want %#v", got, want)
+	}
+	if want, got := []string{"*.tst", "tst"}, l.Files; !reflect.DeepEqual(want, got) {
+		t.Errorf("Files == %#v; want %#v", got, want)
+	}
+	if len(l.FirstLine) != 1 || !l.FirstLine[0].MatchString("#!/bin/test") {
+		t.Errorf("FirstLine == %v; want pattern matching first line", l.FirstLine)
+	}
+	wantTags := []string{"comment.block", "comment.line", "keyword.other",
+		"entity.name.function", "string.quoted"}
+	if !reflect.DeepEqual(wantTags, l.Tags) {
+		t.Errorf("Tags == %#v; want %#v", l.Tags, wantTags)
+	}
+	fragments, _ := syntax(l.Rules).split(`func f /* x */ "s" var // c`,
+		noneState)
+	want := []Fragment{{"func", 2}, {" ", noneTag}, {"f", 3}, {" ", noneTag},
+		{"/* x */", 0}, {" ", noneTag}, {`"s"`, 4}, {" ", noneTag},
+		{"var", 2}, {" ", noneTag}, {"// c", 1}}
+	if !reflect.DeepEqual(want, fragments) {
+		t.Errorf("split returned %v; want %v", fragments, want)
+	}
+
+	// unreadable syntaxes
+	for _, s := range []string{"name: [", "- a", "contexts: &a {}"} {
+		if l, err := ReadSublimeSyntax(strings.NewReader(s)); l != nil ||
+			err == nil {
+			t.Errorf("ReadSublimeSyntax(%#q) returned %v, %v; want nil, error",
+				s, l, err)
+		}
+	}
+}
+
+func TestReadYAML(t *testing.T) {
+	for _, c := range []struct {
+		yaml string
+		want interface{}
+	}{
+		{"a: b\nc:\n  d: e # comment\n  f:\n  - g\n  - h: i\n    j: k\n",
+			map[string]interface{}{"a": "b", "c": map[string]interface{}{
+				"d": "e", "f": []interface{}{"g", map[string]interface{}{
+					"h": "i", "j": "k"}}}}},
+		{"- - a\n  - b\n-\n  c\n- ''\n", []interface{}{
+			[]interface{}{"a", "b"}, "c", ""}},
+		{`a: 'it''s # not a comment'` + "\n" + `"b c": "\t\"\u00e9\\"`,
+			map[string]interface{}{"a": "it's # not a comment",
+				"b c": "\t\"é\\"}},
+		{"a: [b, 'c, d', {e: f, g: [h]}]\nb: {\n  c: d\n}",
+			map[string]interface{}{"a": []interface{}{"b", "c, d",
+				map[string]interface{}{"e": "f", "g": []interface{}{"h"}}},
+				"b": map[string]interface{}{"c": "d"}}},
+		{"a: plain\n  text\nb: http://x#y", map[string]interface{}{
+			"a": "plain text", "b": "http://x#y"}},
+		{"a: |\n  x\n   y\n\n  # z\n# comment\nb: >-\n  x\n  y\n\n  z\n\n",
+			map[string]interface{}{"a": "x\n y\n\n# z\n", "b": "x y\nz"}},
+		{"a: |+\n  x\n\nb: |2-\n    x\n", map[string]interface{}{
+			"a": "x\n\n", "b": "  x"}},
+		{"--- a\n...\nb", "a"},
+		{"", ""},
+	} {
+		got, err := readYAML(strings.NewReader(c.yaml))
+		if err != nil {
+			t.Errorf("readYAML(%#q) returned error: %v", c.yaml, err)
+		} else if !reflect.DeepEqual(c.want, got) {
+			t.Errorf("readYAML(%#q) returned %#v; want %#v", c.yaml, got,
+				c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		yaml, err string
+	}{
+		{"a:\n\t- b", "line 2: tab in indentation"},
+		{"a: b\n  c: d", "line 2: bad indentation"},
+		{"a: b\na: c", `line 2: duplicate key "a"`},
+		{"a: *b", "line 1: anchors, aliases, and tags are not supported"},
+		{"a: 'b", "line 1: unterminated scalar or collection"},
+		{`a: "\q"`, `line 1: invalid escape "\\q\""`},
+		{"a: [b c: d]", `line 1: expected "," or "]" before ": d]"`},
+		{"- a\nb: c", "line 2: bad indentation"},
+	} {
+		if _, err := readYAML(strings.NewReader(c.yaml)); err == nil ||
+			err.Error() != c.err {
+			t.Errorf("readYAML(%#q) returned error %v; want %v", c.yaml, err,
+				c.err)
+		}
+	}
+}
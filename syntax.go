@@ -4,10 +4,15 @@ import "regexp"
 
 const noneTag = -1
 
+// noneState is the syntax state outside of any region.
+const noneState = -1
+
 // Rule is a rule for matching syntax and applying a tag to it.
 type Rule struct {
-	re  *regexp.Regexp
-	tag int
+	re       *regexp.Regexp
+	end      *regexp.Regexp // end of region, or nil if not a region rule
+	tag      int
+	captures []int // tags of subexpressions
 }
 
 // NewRule returns an initialized Rule by compiling pattern into a regular
@@ -17,7 +22,79 @@ func NewRule(pattern string, tag int) (Rule, error) {
 	if err != nil {
 		return Rule{}, err
 	}
-	return Rule{re, tag}, nil
+	return Rule{re: re, tag: tag}, nil
+}
+
+// NewRegionRule returns an initialized Rule that applies a tag to a region
+// beginning with a match of begin and ending with the next match of end,
+// which may be on a later line. If end is not matched, the region extends to
+// the end of the text. An error is returned if either pattern fails to
+// compile.
+func NewRegionRule(begin, end string, tag int) (Rule, error) {
+	rule, err := NewRule(begin, tag)
+	if err != nil {
+		return Rule{}, err
+	}
+	if rule.end, err = regexp.Compile(end); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// NewCaptureRule returns an initialized Rule that applies different tags to
+// the text matched by the parenthesized subexpressions of pattern. The tag
+// for subexpression i is captures[i-1]; if it is negative or not given, the
+// subexpression is not tagged separately. Text in the match that is not
+// matched by a separately tagged subexpression is tagged with tag, and the
+// tags of nested subexpressions take precedence over the tags of the
+// subexpressions containing them. An error is returned if pattern fails to
+// compile.
+func NewCaptureRule(pattern string, tag int, captures ...int) (Rule,
+	error) {
+	rule, err := NewRule(pattern, tag)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.captures = captures
+	return rule, nil
+}
+
+// find returns the location of the leftmost match of the rule in s, with
+// the locations of subexpressions if the rule tags them.
+func (rule Rule) find(s string) []int {
+	if rule.captures != nil {
+		return rule.re.FindStringSubmatchIndex(s)
+	}
+	return rule.re.FindStringIndex(s)
+}
+
+// fragments returns the tagged fragments of the text matched in s at loc.
+func (rule Rule) fragments(s string, loc []int) []Fragment {
+	if rule.captures == nil {
+		return []Fragment{{s[loc[0]:loc[1]], rule.tag}}
+	}
+	tags := make([]int, loc[1]-loc[0])
+	for i := range tags {
+		tags[i] = rule.tag
+	}
+	for i, tag := range rule.captures {
+		if 2*i+3 >= len(loc) || tag < 0 || loc[2*i+2] < 0 {
+			continue
+		}
+		for j := loc[2*i+2]; j < loc[2*i+3]; j++ {
+			tags[j-loc[0]] = tag
+		}
+	}
+	var fragments []Fragment
+	start := 0
+	for i := 1; i <= len(tags); i++ {
+		if i == len(tags) || tags[i] != tags[start] {
+			fragments = append(fragments,
+				Fragment{s[loc[0]+start : loc[0]+i], tags[start]})
+			start = i
+		}
+	}
+	return fragments
 }
 
 // Fragment is a string annotated with a tag.
@@ -28,55 +105,93 @@ type Fragment struct {
 
 type syntax []Rule
 
-func (rules syntax) split(s string) <-chan Fragment {
-	c := make(chan Fragment)
-	go func() {
-		if s == "" {
-			c <- Fragment{s, noneTag}
+// split divides a line of text into tagged fragments. The state is the index
+// of the region rule whose region is open at the beginning of the line, or
+// noneState; the state at the end of the line is returned with the fragments.
+func (rules syntax) split(s string, state int) ([]Fragment, int) {
+	var fragments []Fragment
+	if s == "" {
+		tag := noneTag
+		if state != noneState {
+			tag = rules[state].tag
 		}
+		return append(fragments, Fragment{s, tag}), state
+	}
 
-		minLocs := make(map[Rule][]int)
+	minLocs := make([][]int, len(rules))
+	opened := "" // text of region opened on this line
 
-		for s != "" {
-			// Find the first matching rule
-			var minLoc []int
-			var minRule Rule
-			for _, rule := range rules {
-				var loc []int
-				if v := minLocs[rule]; v != nil {
-					loc = v
-				} else {
-					loc = rule.re.FindStringIndex(s)
-				}
-				if loc != nil {
-					minLocs[rule] = loc
-					if minLoc == nil || loc[0] < minLoc[0] {
-						minLoc = loc
-						minRule = rule
-					}
+	for s != "" {
+		// Close an open region
+		if state != noneState {
+			rule := rules[state]
+			loc := rule.end.FindStringIndex(s)
+			if loc == nil {
+				fragments = append(fragments, Fragment{opened + s, rule.tag})
+				break
+			}
+			fragments = append(fragments,
+				Fragment{opened + s[:loc[1]], rule.tag})
+			s, opened = s[loc[1]:], ""
+			for i := range minLocs {
+				minLocs[i] = nil
+			}
+			state = noneState
+			continue
+		}
+
+		// Find the first matching rule
+		var minLoc []int
+		minRule := 0
+		for i, rule := range rules {
+			loc := minLocs[i]
+			if loc == nil {
+				loc = rule.find(s)
+			}
+			if loc != nil {
+				minLocs[i] = loc
+				if minLoc == nil || loc[0] < minLoc[0] {
+					minLoc = loc
+					minRule = i
 				}
 			}
-			// Send fragments
-			if minLoc == nil {
-				c <- Fragment{s, noneTag}
-				s = ""
+		}
+		// Append fragments
+		if minLoc == nil {
+			fragments = append(fragments, Fragment{s, noneTag})
+			s = ""
+		} else {
+			if minLoc[0] > 0 {
+				fragments = append(fragments, Fragment{s[:minLoc[0]], noneTag})
+			}
+			if rules[minRule].end != nil {
+				// Open a region; its text is appended when it is closed
+				opened = s[minLoc[0]:minLoc[1]]
+				state = minRule
 			} else {
-				if minLoc[0] > 0 {
-					c <- Fragment{s[:minLoc[0]], noneTag}
+				fragments = append(fragments,
+					rules[minRule].fragments(s, minLoc)...)
+			}
+			s = s[minLoc[1]:]
+			for k, v := range minLocs {
+				if v == nil {
+					continue
+				}
+				if v[0] < minLoc[1] {
+					minLocs[k] = nil
+					continue
 				}
-				c <- Fragment{s[minLoc[0]:minLoc[1]], minRule.tag}
-				s = s[minLoc[1]:]
-				for k, v := range minLocs {
-					if v[0] < minLoc[1] {
-						delete(minLocs, k)
-					} else {
-						v[0] -= minLoc[1]
-						v[1] -= minLoc[1]
+				for j := range v {
+					if v[j] >= 0 {
+						v[j] -= minLoc[1]
 					}
 				}
 			}
 		}
-		close(c)
-	}()
-	return c
+	}
+	if opened != "" && s == "" {
+		// Region opened at end of line
+		fragments = append(fragments, Fragment{opened, rules[state].tag})
+	}
+	return fragments, state
 }
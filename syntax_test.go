@@ -1,6 +1,9 @@
 package edit
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestNewRule(t *testing.T) {
 	if _, err := NewRule("b", 0); err != nil {
@@ -11,54 +14,87 @@ func TestNewRule(t *testing.T) {
 	}
 }
 
-func TestSyntaxSplit(t *testing.T) {
-	// Test empty string
-	var rules syntax = []Rule{}
-	c := rules.split("")
-	if want, got := (Fragment{"", noneTag}), <-c; want != got {
-		t.Errorf("<-c == %#v; want %#v", got, want)
+func TestNewRegionRule(t *testing.T) {
+	if _, err := NewRegionRule("b", "e", 0); err != nil {
+		t.Error("NewRegionRule returned error for valid patterns")
 	}
-	if _, ok := <-c; ok {
-		t.Error("channel should be closed")
+	if _, err := NewRegionRule("b\\", "e", 0); err == nil {
+		t.Error("NewRegionRule did not return error for invalid pattern")
 	}
+	if _, err := NewRegionRule("b", "e\\", 0); err == nil {
+		t.Error("NewRegionRule did not return error for invalid pattern")
+	}
+}
 
-	// Test no rules
-	c = rules.split("hello")
-	if want, got := (Fragment{"hello", noneTag}), <-c; want != got {
-		t.Errorf("<-c == %#v; want %#v", got, want)
+func TestNewCaptureRule(t *testing.T) {
+	if _, err := NewCaptureRule(`(b)`, 0, 1); err != nil {
+		t.Error("NewCaptureRule returned error for valid pattern")
 	}
-	if _, ok := <-c; ok {
-		t.Error("channel should be closed")
+	if _, err := NewCaptureRule(`(b\\`, 0, 1); err == nil {
+		t.Error("NewCaptureRule did not return error for invalid pattern")
 	}
+}
+
+// testSplit checks the result of rules.split against fragments and state.
+func testSplit(t *testing.T, rules syntax, s string, state int,
+	fragments []Fragment, wantState int) {
+	got, gotState := rules.split(s, state)
+	if !reflect.DeepEqual(fragments, got) {
+		t.Errorf("split(%#v, %v) returned fragments %#v; want %#v", s, state,
+			got, fragments)
+	}
+	if wantState != gotState {
+		t.Errorf("split(%#v, %v) returned state %v; want %v", s, state,
+			gotState, wantState)
+	}
+}
+
+func TestSyntaxSplit(t *testing.T) {
+	// Test empty string
+	var rules syntax = []Rule{}
+	testSplit(t, rules, "", noneState, []Fragment{{"", noneTag}}, noneState)
+
+	// Test no rules
+	testSplit(t, rules, "hello", noneState, []Fragment{{"hello", noneTag}},
+		noneState)
 
 	// Test begin-only rule
 	keywordRule, _ := NewRule("(var|const)", 0)
 	rules = []Rule{keywordRule}
-	fragments := []Fragment{{"var", 0}, {" def ", noneTag}, {"const", 0}}
-	c = rules.split("var def const")
-	for _, frag := range fragments {
-		if want, got := frag, <-c; want != got {
-			t.Errorf("<-c == %#v; want %#v", got, want)
-		}
-	}
-	if _, ok := <-c; ok {
-		t.Error("channel should be closed")
-	}
+	testSplit(t, rules, "var def const", noneState,
+		[]Fragment{{"var", 0}, {" def ", noneTag}, {"const", 0}}, noneState)
 
 	// Test begin and end rules
 	commentRule, _ := NewRule(`/\*.+?\*/`, 1)
 	rules = []Rule{keywordRule, commentRule}
-	fragments = []Fragment{{"var", 0}, {"/*var*/", 1}, {"const", 0},
-		{"/*", noneTag}, {"const", 0}}
-	c = rules.split("var/*var*/const/*const")
-	for _, frag := range fragments {
-		if want, got := frag, <-c; want != got {
-			t.Errorf("<-c == %#v; want %#v", got, want)
-		}
-	}
-	if _, ok := <-c; ok {
-		t.Error("channel should be closed")
-	}
+	testSplit(t, rules, "var/*var*/const/*const", noneState,
+		[]Fragment{{"var", 0}, {"/*var*/", 1}, {"const", 0}, {"/*", noneTag},
+			{"const", 0}}, noneState)
+
+	// Test region rules
+	regionRule, _ := NewRegionRule(`/\*`, `\*/`, 1)
+	rules = []Rule{keywordRule, regionRule}
+	testSplit(t, rules, "var/*var*/const/*/const", noneState,
+		[]Fragment{{"var", 0}, {"/*var*/", 1}, {"const", 0},
+			{"/*/const", 1}}, 1)
+	testSplit(t, rules, "var */ const", 1,
+		[]Fragment{{"var */", 1}, {" ", noneTag}, {"const", 0}}, noneState)
+	testSplit(t, rules, "var", 1, []Fragment{{"var", 1}}, 1)
+	testSplit(t, rules, "", 1, []Fragment{{"", 1}}, 1)
+	testSplit(t, rules, "const /*", noneState,
+		[]Fragment{{"const", 0}, {" ", noneTag}, {"/*", 1}}, 1)
+
+	// Test capture rules
+	funcRule, _ := NewCaptureRule(`(func) (\w+)(\((\w*)\))?`, 2, 0, 3, -1, 4)
+	rules = []Rule{keywordRule, funcRule}
+	testSplit(t, rules, "var func f(x) {} func g", noneState,
+		[]Fragment{{"var", 0}, {" ", noneTag}, {"func", 0}, {" ", 2},
+			{"f", 3}, {"(", 2}, {"x", 4}, {")", 2}, {" {} ", noneTag},
+			{"func", 0}, {" ", 2}, {"g", 3}}, noneState)
+	rules = []Rule{funcRule, keywordRule}
+	testSplit(t, rules, "func f() var", noneState,
+		[]Fragment{{"func", 0}, {" ", 2}, {"f", 3}, {"()", 2},
+			{" ", noneTag}, {"var", 0}}, noneState)
 }
 
 const testSource = `package main
@@ -83,7 +119,7 @@ var (
 	goRules syntax = []Rule{keywordRule, numRule, stringRule, commentRule}
 )
 
-// Current benchmark: 240000 ns/op
+// Current benchmark: 29000 ns/op (240000 ns/op with goroutine)
 func BenchmarkSyntaxSplit(b *testing.B) {
 	// Make sure the rules work
 	fragments := []Fragment{{"package", 0}, {" main\n\n", noneTag},
@@ -91,22 +127,13 @@ func BenchmarkSyntaxSplit(b *testing.B) {
 		{"func", 0}, {" main() {\n\tv := ", noneTag}, {"42", 1},
 		{" ", noneTag}, {"// change me!\n", 2}, {"\tfmt.Printf(", noneTag},
 		{`"v is of type %T\n"`, 1}, {", v)\n}\n", noneTag}}
-	c := goRules.split(testSource)
-	for _, frag := range fragments {
-		if want, got := frag, <-c; want != got {
-			b.Fatalf("<-c == %#v; want %#v", got, want)
-		}
-	}
-	if _, ok := <-c; ok {
-		b.Fatal("channel should be closed")
+	if got, _ := goRules.split(testSource, noneState); !reflect.DeepEqual(fragments, got) {
+		b.Fatalf("split returned %#v; want %#v", got, fragments)
 	}
 
 	// Benchmark
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		c = goRules.split(testSource)
-		for _ = range c {
-			// Do nothing
-		}
+		goRules.split(testSource, noneState)
 	}
 }
@@ -1,50 +1,45 @@
 package edit
 
-var (
-	p         []rune              // Reuse the same array
-	tabUnlock = make(chan int, 1) // And use a channel as mutex
-)
+// cell is a grapheme cluster of a line as displayed. Tabs are expanded to
+// spaces, each of which is a separate cell.
+type cell struct {
+	char   int // index in the line of the first rune of the cluster
+	offset int // offset of the cell's text in the expanded line
+	n      int // length of the cell's text in runes
+	width  int // width in columns
 
-func init() {
-	tabUnlock <- 1
+	// virtual is 1 + the index of the annotation whose text the cell holds,
+	// or 0 if the cell holds text of the line. The offset of a virtual cell
+	// is in the expanded text of the annotation.
+	virtual int
 }
 
-// Expand tabs to spaces; tabWidth must be > 0
-func expand(s []rune, tabWidth int) []rune {
-	<-tabUnlock
-	if len(p) < tabWidth*len(s) {
-		p = make([]rune, tabWidth*len(s))
-	}
+// expand expands tabs in s to spaces and returns the expanded text and its
+// cells. Tab stops are every tabWidth columns, counting wide characters as
+// two columns; tabWidth must be > 0.
+func expand(s []rune, tabWidth int) ([]rune, []cell) {
+	text := make([]rune, 0, len(s))
+	cells := make([]cell, 0, len(s))
 	col := 0
-
-	for _, ch := range s {
-		if ch == '\t' {
-			p[col] = ' '
-			col++
-			for col%tabWidth != 0 {
-				p[col] = ' '
+	for char := 0; char < len(s); {
+		if s[char] == '\t' {
+			for {
+				cells = append(cells, cell{char, len(text), 1, 1, 0})
+				text = append(text, ' ')
 				col++
+				if col%tabWidth == 0 {
+					break
+				}
 			}
-		} else {
-			p[col] = ch
-			col++
-		}
-	}
-
-	s = p[:col]
-	tabUnlock <- 1
-	return s
-}
-
-// Return width of expanded string in columns; tabWidth must be > 0
-func columns(s []rune, tabWidth int) int {
-	col := 0
-	for _, ch := range s {
-		if ch == '\t' {
-			col += tabWidth - col%tabWidth
-		} else {
-			col++
+			char++
+			continue
 		}
+		n := clusterLen(s[char:])
+		c := cell{char, len(text), n, clusterWidth(s[char : char+n]), 0}
+		cells = append(cells, c)
+		text = append(text, s[char:char+n]...)
+		col += c.width
+		char += n
 	}
-	return col
+	return text, cells
 }
@@ -4,19 +4,30 @@ import "testing"
 
 func TestExpand(t *testing.T) {
 	want := "12 123      1234  1"
-	got := string(expand([]rune("12\t123\t\t1234\t1"), 3))
-	if want != got {
-		t.Errorf("expand() == %#v; want %#v", got, want)
+	got, _ := expand([]rune("12\t123\t\t1234\t1"), 3)
+	if want != string(got) {
+		t.Errorf("expand() == %#v; want %#v", string(got), want)
 	}
-	// test mutex unlock
-	want, got = "", string(expand([]rune(""), 8))
-	if want != got {
-		t.Errorf("expand() == %#v; want %#v", got, want)
+	want = ""
+	if got, _ := expand([]rune(""), 8); want != string(got) {
+		t.Errorf("expand() == %#v; want %#v", string(got), want)
 	}
-}
 
-func TestColumns(t *testing.T) {
-	if want, got := 19, columns([]rune("12\t123\t\t1234\t1"), 3); want != got {
-		t.Errorf("columns() == %#v; want %#v", got, want)
+	// wide characters and clusters
+	want = "日 e\u0301  x"
+	text, cells := expand([]rune("日\te\u0301\tx"), 3)
+	if want != string(text) {
+		t.Errorf("expand() == %#v; want %#v", string(text), want)
+	}
+	wantCells := []cell{{0, 0, 1, 2, 0}, {1, 1, 1, 1, 0}, {2, 2, 2, 1, 0},
+		{4, 4, 1, 1, 0}, {4, 5, 1, 1, 0}, {5, 6, 1, 1, 0}}
+	if len(wantCells) != len(cells) {
+		t.Fatalf("expand() returned %v cells; want %v", cells, wantCells)
+	}
+	for i := range cells {
+		if wantCells[i] != cells[i] {
+			t.Errorf("expand() returned cell %#v; want %#v", cells[i],
+				wantCells[i])
+		}
 	}
 }
@@ -0,0 +1,344 @@
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefinitionErrors is a list of problems in a syntax definition.
+type DefinitionErrors []*DefinitionError
+
+func (e DefinitionErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "edit: no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", e[0], len(e)-1)
+}
+
+// ReadTextMate reads a TextMate grammar in JSON or XML property list form
+// (a .tmLanguage or .tmLanguage.json file) from r and converts it to a
+// Language. Sublime Text's YAML .sublime-syntax format is read by
+// ReadSublimeSyntax.
+//
+// The grammar's fileTypes and firstLineMatch determine the Language's Files
+// and FirstLine, and its scope names become tag names. Of its rules, "match"
+// rules with "name" and "captures", "begin" and "end" rules with "name" or
+// "contentName", and "include" of repository rules ("#name") are supported.
+// Other constructs, and patterns that are not valid Go regular expressions,
+// cannot be represented. They are reported in a DefinitionErrors, but the
+// rest of the grammar is still converted: rules that cannot be represented
+// are omitted, and unsupported parts of other rules are ignored. If the
+// grammar cannot be read at all, the returned Language is nil.
+func ReadTextMate(r io.Reader) (*Language, error) {
+	br := bufio.NewReader(r)
+	var grammar interface{}
+	var err error
+	if first, _ := skipSpace(br); first == '{' {
+		err = json.NewDecoder(br).Decode(&grammar)
+	} else {
+		grammar, err = readPlist(br)
+	}
+	if err != nil {
+		return nil, &DefinitionError{Err: err.Error()}
+	}
+	root, ok := grammar.(map[string]interface{})
+	if !ok {
+		return nil, &DefinitionError{Err: "grammar is not a dictionary"}
+	}
+
+	c := &tmConverter{l: &Language{}, included: make(map[string]bool)}
+	c.l.Name, _ = root["name"].(string)
+	if c.l.Name == "" {
+		c.l.Name, _ = root["scopeName"].(string)
+	}
+	fileTypes, _ := root["fileTypes"].([]interface{})
+	for _, v := range fileTypes {
+		if s, ok := v.(string); ok {
+			c.l.Files = append(c.l.Files, "*."+s, s)
+		}
+	}
+	if s, ok := root["firstLineMatch"].(string); ok {
+		if re, err := regexp.Compile(s); err != nil {
+			c.error("firstLineMatch", err.Error())
+		} else {
+			c.l.FirstLine = append(c.l.FirstLine, re)
+		}
+	}
+	c.repository, _ = root["repository"].(map[string]interface{})
+	c.patterns(root["patterns"], "patterns")
+	if len(c.errs) > 0 {
+		return c.l, c.errs
+	}
+	return c.l, nil
+}
+
+// skipSpace discards leading white space from r and returns the next byte
+// without consuming it.
+func skipSpace(r *bufio.Reader) (byte, error) {
+	for {
+		p, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(p[0])) {
+			return p[0], nil
+		}
+		r.ReadByte()
+	}
+}
+
+// tmConverter holds the state of a TextMate grammar or Sublime Text syntax
+// conversion.
+type tmConverter struct {
+	l          *Language
+	repository map[string]interface{} // repository rules, or contexts
+	included   map[string]bool        // repository rules being included
+	variables  map[string]string      // variables of a Sublime Text syntax
+	errs       DefinitionErrors
+}
+
+func (c *tmConverter) error(path, err string) {
+	c.errs = append(c.errs, &DefinitionError{path, err})
+}
+
+// patterns converts a list of rules.
+func (c *tmConverter) patterns(v interface{}, path string) {
+	if v == nil {
+		return
+	}
+	patterns, ok := v.([]interface{})
+	if !ok {
+		c.error(path, "not an array")
+		return
+	}
+	for i, p := range patterns {
+		c.rule(p, fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+// rule converts a rule.
+func (c *tmConverter) rule(v interface{}, path string) {
+	rule, ok := v.(map[string]interface{})
+	if !ok {
+		c.error(path, "not a dictionary")
+		return
+	}
+	name, _ := rule["name"].(string)
+	match, _ := rule["match"].(string)
+	begin, _ := rule["begin"].(string)
+	end, _ := rule["end"].(string)
+	include, _ := rule["include"].(string)
+
+	switch {
+	case include != "":
+		c.include(include, path)
+	case match != "":
+		// Check the pattern first so that tags of an omitted rule aren't
+		// defined
+		if _, err := regexp.Compile(match); err != nil {
+			c.error(path+".match", err.Error())
+			return
+		}
+		captures, tag := c.captures(rule["captures"], path+".captures")
+		if tag == noneTag {
+			tag = c.l.tag(name)
+		}
+		r, _ := NewCaptureRule(match, tag, captures...)
+		c.l.Rules = append(c.l.Rules, r)
+	case begin != "":
+		if _, ok := rule["while"]; ok {
+			c.error(path+".while", "not supported")
+			return
+		} else if end == "" {
+			c.error(path+".end", "missing")
+			return
+		}
+		for _, key := range []string{"beginCaptures", "endCaptures",
+			"captures", "patterns"} {
+			if _, ok := rule[key]; ok {
+				c.error(path+"."+key,
+					"not supported for begin and end rules; ignored")
+			}
+		}
+		if name == "" {
+			name, _ = rule["contentName"].(string)
+		}
+		if _, err := regexp.Compile(begin); err != nil {
+			c.error(path+".begin", err.Error())
+			return
+		} else if _, err := regexp.Compile(end); err != nil {
+			c.error(path+".end", err.Error())
+			return
+		}
+		r, _ := NewRegionRule(begin, end, c.l.tag(name))
+		c.l.Rules = append(c.l.Rules, r)
+	case rule["patterns"] != nil:
+		// A rule that only groups other rules
+		c.patterns(rule["patterns"], path+".patterns")
+	default:
+		c.error(path, "missing match, begin, or include")
+	}
+}
+
+// include converts the rules referred to by an include.
+func (c *tmConverter) include(ref, path string) {
+	if !strings.HasPrefix(ref, "#") {
+		c.error(path+".include", fmt.Sprintf(
+			"including %#v is not supported; only repository rules (#name) "+
+				"can be included", ref))
+		return
+	}
+	key := ref[1:]
+	rule, ok := c.repository[key]
+	if !ok {
+		c.error(path+".include", fmt.Sprintf("no repository rule %#v", key))
+		return
+	}
+	if c.included[key] {
+		c.error(path+".include", fmt.Sprintf(
+			"recursive include of %#v is not supported", ref))
+		return
+	}
+	c.included[key] = true
+	c.rule(rule, "repository."+key)
+	delete(c.included, key)
+}
+
+// captures converts a dictionary of captures to the tags of subexpressions
+// in the form used by NewCaptureRule. The tag of capture 0, if any, is also
+// returned, or noneTag. In a Sublime Text syntax, captures map to scope
+// names rather than dictionaries.
+func (c *tmConverter) captures(v interface{}, path string) ([]int, int) {
+	tag := noneTag
+	if v == nil {
+		return nil, tag
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		c.error(path, "not a dictionary")
+		return nil, tag
+	}
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var captures []int
+	for _, key := range keys {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 {
+			c.error(path+"."+key, "not a capture number")
+			continue
+		}
+		name, ok := dict[key].(string)
+		if !ok {
+			capture, _ := dict[key].(map[string]interface{})
+			if _, ok := capture["patterns"]; ok {
+				c.error(path+"."+key+".patterns", "not supported; ignored")
+			}
+			name, _ = capture["name"].(string)
+		}
+		if i == 0 {
+			tag = c.l.tag(name)
+			continue
+		}
+		for len(captures) < i {
+			captures = append(captures, noneTag)
+		}
+		captures[i-1] = c.l.tag(name)
+	}
+	return captures, tag
+}
+
+// readPlist reads an XML property list from r. Dictionaries, arrays, and
+// strings are returned as map[string]interface{}, []interface{}, and string
+// values; other values are returned as strings of their text.
+func readPlist(r io.Reader) (interface{}, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if start, ok := t.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return readPlistValue(d, start)
+		}
+	}
+}
+
+// readPlistValue reads the value of a property list element that begins with
+// start.
+func readPlistValue(d *xml.Decoder, start xml.StartElement) (interface{},
+	error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		key := ""
+		for {
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := t.(type) {
+			case xml.StartElement:
+				v, err := readPlistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				if t.Name.Local == "key" {
+					key, _ = v.(string)
+				} else {
+					dict[key] = v
+				}
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			t, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := t.(type) {
+			case xml.StartElement:
+				v, err := readPlistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, v)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	}
+	var text bytes.Buffer
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			return text.String(), nil
+		}
+	}
+}
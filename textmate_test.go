@@ -0,0 +1,147 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTextMateJSON = `{
+	"name": "Test",
+	"scopeName": "source.test",
+	"fileTypes": ["tst"],
+	"firstLineMatch": "^#!.*test",
+	"patterns": [
+		{"include": "#comments"},
+		{
+			"match": "(func) (\\w+)",
+			"captures": {
+				"1": {"name": "keyword.other"},
+				"2": {"name": "entity.name.function"}
+			}
+		},
+		{"match": "\\bvar\\b", "name": "keyword.other"},
+		{
+			"begin": "\"",
+			"end": "\"",
+			"name": "string.quoted",
+			"patterns": [{"match": "\\\\.", "name": "constant.escape"}]
+		},
+		{"match": "a(?=b)", "name": "invalid"},
+		{"include": "source.other"},
+		{"include": "#missing"},
+		{"include": "#recursive"}
+	],
+	"repository": {
+		"comments": {
+			"patterns": [
+				{"begin": "/\\*", "end": "\\*/", "name": "comment.block"},
+				{"match": "//.*", "name": "comment.line"}
+			]
+		},
+		"recursive": {"patterns": [{"include": "#recursive"}]}
+	}
+}`
+
+const testTextMatePlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>Test</string>
+	<key>fileTypes</key>
+	<array>
+		<string>tst</string>
+	</array>
+	<key>patterns</key>
+	<array>
+		<dict>
+			<key>match</key>
+			<string>\b(func|var)\b</string>
+			<key>name</key>
+			<string>keyword.other</string>
+		</dict>
+		<dict>
+			<key>begin</key>
+			<string>&lt;!--</string>
+			<key>end</key>
+			<string>--&gt;</string>
+			<key>name</key>
+			<string>comment.block</string>
+		</dict>
+	</array>
+</dict>
+</plist>`
+
+func TestReadTextMate(t *testing.T) {
+	l, err := ReadTextMate(strings.NewReader(testTextMateJSON))
+	if l == nil {
+		t.Fatalf("ReadTextMate returned nil Language; error: %v", err)
+	}
+	errs, ok := err.(DefinitionErrors)
+	if !ok {
+		t.Fatalf("ReadTextMate returned error %#v; want DefinitionErrors", err)
+	}
+	wantErrs := []string{
+		"patterns[3].patterns: not supported for begin and end rules; ignored",
+		"patterns[4].match: error parsing regexp: invalid or unsupported " +
+			"Perl syntax: `(?=`",
+		`patterns[5].include: including "source.other" is not supported; ` +
+			"only repository rules (#name) can be included",
+		`patterns[6].include: no repository rule "missing"`,
+		`repository.recursive.patterns[0].include: recursive include of ` +
+			`"#recursive" is not supported`,
+	}
+	if len(errs) != len(wantErrs) {
+		t.Errorf("ReadTextMate returned %v errors; want %v", len(errs),
+			len(wantErrs))
+	}
+	for i := 0; i < len(errs) && i < len(wantErrs); i++ {
+		want := "edit: syntax definition: " + wantErrs[i]
+		if got := errs[i].Error(); want != got {
+			t.Errorf("ReadTextMate returned error %#q; want %#q", got, want)
+		}
+	}
+
+	if want, got := "Test", l.Name; want != got {
+		t.Errorf("Name == %#v; want %#v", got, want)
+	}
+	if want, got := []string{"*.tst", "tst"}, l.Files; !reflect.DeepEqual(want, got) {
+		t.Errorf("Files == %#v; want %#v", got, want)
+	}
+	if len(l.FirstLine) != 1 || !l.FirstLine[0].MatchString("#!/bin/test") {
+		t.Errorf("FirstLine == %v; want pattern matching first line", l.FirstLine)
+	}
+	wantTags := []string{"comment.block", "comment.line", "keyword.other",
+		"entity.name.function", "string.quoted"}
+	if !reflect.DeepEqual(wantTags, l.Tags) {
+		t.Errorf("Tags == %#v; want %#v", l.Tags, wantTags)
+	}
+	fragments, _ := syntax(l.Rules).split(`func f /* x */ "s" var // c`,
+		noneState)
+	want := []Fragment{{"func", 2}, {" ", noneTag}, {"f", 3}, {" ", noneTag},
+		{"/* x */", 0}, {" ", noneTag}, {`"s"`, 4}, {" ", noneTag},
+		{"var", 2}, {" ", noneTag}, {"// c", 1}}
+	if !reflect.DeepEqual(want, fragments) {
+		t.Errorf("split returned %v; want %v", fragments, want)
+	}
+
+	// XML property list
+	l, err = ReadTextMate(strings.NewReader(testTextMatePlist))
+	if err != nil {
+		t.Fatalf("ReadTextMate returned error: %v", err)
+	}
+	fragments, _ = syntax(l.Rules).split("<!-- var --> var", noneState)
+	want = []Fragment{{"<!-- var -->", 1}, {" ", noneTag}, {"var", 0}}
+	if !reflect.DeepEqual(want, fragments) {
+		t.Errorf("split returned %v; want %v", fragments, want)
+	}
+
+	// unreadable grammars
+	for _, s := range []string{`{"name": `, `<plist><dict>`, `[]`} {
+		if l, err := ReadTextMate(strings.NewReader(s)); l != nil || err == nil {
+			t.Errorf("ReadTextMate(%#q) returned %v, %v; want nil, error", s,
+				l, err)
+		}
+	}
+}
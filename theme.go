@@ -0,0 +1,236 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Color is a 24-bit RGB color, or DefaultColor.
+type Color uint32
+
+// DefaultColor denotes the absence of a color, so that an inherited color or
+// the front end's default color is used.
+const DefaultColor Color = 0
+
+// RGB returns the Color with the given red, green, and blue components.
+func RGB(r, g, b uint8) Color {
+	return Color(1<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b))
+}
+
+// RGB returns the red, green, and blue components of c. The components of
+// DefaultColor are all zero.
+func (c Color) RGB() (r, g, b uint8) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c)
+}
+
+// String returns c in the form "#rrggbb", or "default" for DefaultColor.
+func (c Color) String() string {
+	if c == DefaultColor {
+		return "default"
+	}
+	return fmt.Sprintf("#%06x", uint32(c)&0xffffff)
+}
+
+// parseColor parses a color in the form "#rrggbb" or "#rgb".
+func parseColor(s string) (Color, error) {
+	if len(s) == 4 && s[0] == '#' {
+		s = string([]byte{'#', s[1], s[1], s[2], s[2], s[3], s[3]})
+	}
+	if len(s) != 7 || s[0] != '#' {
+		return DefaultColor, fmt.Errorf("invalid color %#v", s)
+	}
+	n, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return DefaultColor, fmt.Errorf("invalid color %#v", s)
+	}
+	return RGB(uint8(n>>16), uint8(n>>8), uint8(n)), nil
+}
+
+// Toggle is the setting of a style attribute.
+type Toggle int8
+
+// Toggle settings.
+const (
+	Inherit Toggle = iota // use the inherited setting
+	On
+	Off
+)
+
+// Style describes the appearance of text.
+type Style struct {
+	Fg, Bg                  Color
+	Bold, Italic, Underline Toggle
+}
+
+// inherit returns s with its unset attributes taken from parent.
+func (s Style) inherit(parent Style) Style {
+	if s.Fg == DefaultColor {
+		s.Fg = parent.Fg
+	}
+	if s.Bg == DefaultColor {
+		s.Bg = parent.Bg
+	}
+	if s.Bold == Inherit {
+		s.Bold = parent.Bold
+	}
+	if s.Italic == Inherit {
+		s.Italic = parent.Italic
+	}
+	if s.Underline == Inherit {
+		s.Underline = parent.Underline
+	}
+	return s
+}
+
+// Theme maps hierarchical tag names to styles. Tag names are composed of
+// components separated by dots, such as "string.escape", and a tag inherits
+// each attribute its style does not set from the tag named by its leading
+// components ("string"), and ultimately from the theme's default style, which
+// is named by the empty string. A Theme is not modified after it is created,
+// so it is safe for concurrent use.
+type Theme struct {
+	styles map[string]Style
+}
+
+// NewTheme returns a Theme with the given styles, keyed by tag name.
+func NewTheme(styles map[string]Style) *Theme {
+	t := &Theme{make(map[string]Style, len(styles))}
+	for name, style := range styles {
+		t.styles[name] = style
+	}
+	return t
+}
+
+// jsonStyle is the JSON form of a Style.
+type jsonStyle struct {
+	Fg        string `json:"fg"`
+	Bg        string `json:"bg"`
+	Bold      *bool  `json:"bold"`
+	Italic    *bool  `json:"italic"`
+	Underline *bool  `json:"underline"`
+}
+
+// toggle returns the Toggle setting for an optional boolean.
+func toggle(b *bool) Toggle {
+	if b == nil {
+		return Inherit
+	} else if *b {
+		return On
+	}
+	return Off
+}
+
+// ReadTheme reads a Theme defined in JSON from r. The definition is an
+// object mapping tag names to styles, as in:
+//
+//	{
+//		"": {"fg": "#d0d0d0", "bg": "#202020"},
+//		"comment": {"fg": "#808080", "italic": true},
+//		"comment.doc": {"bold": true}
+//	}
+//
+// Colors have the form "#rrggbb" or "#rgb". Omitted attributes are
+// inherited.
+func ReadTheme(r io.Reader) (*Theme, error) {
+	var def map[string]jsonStyle
+	if err := json.NewDecoder(r).Decode(&def); err != nil {
+		return nil, fmt.Errorf("edit: theme: %v", err)
+	}
+	t := &Theme{make(map[string]Style, len(def))}
+	for name, js := range def {
+		style := Style{
+			Bold:      toggle(js.Bold),
+			Italic:    toggle(js.Italic),
+			Underline: toggle(js.Underline),
+		}
+		var err error
+		if js.Fg != "" {
+			if style.Fg, err = parseColor(js.Fg); err != nil {
+				return nil, fmt.Errorf("edit: theme: %#v: fg: %v", name, err)
+			}
+		}
+		if js.Bg != "" {
+			if style.Bg, err = parseColor(js.Bg); err != nil {
+				return nil, fmt.Errorf("edit: theme: %#v: bg: %v", name, err)
+			}
+		}
+		t.styles[name] = style
+	}
+	return t, nil
+}
+
+// Style returns the style for the tag with name, with inherited attributes
+// resolved. Toggles in the returned style are On or Off, and colors not set
+// by the theme are DefaultColor.
+func (t *Theme) Style(name string) Style {
+	style := t.styles[name]
+	for name != "" {
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[:i]
+		} else {
+			name = ""
+		}
+		style = style.inherit(t.styles[name])
+	}
+	return style.inherit(Style{Bold: Off, Italic: Off, Underline: Off})
+}
+
+// FragmentStyle returns the style for f, a fragment of text highlighted
+// using the rules of l. Fragments with display tags, such as wrap markers and
+// fold placeholders, are styled by the tag's name instead.
+func (t *Theme) FragmentStyle(l *Language, f Fragment) Style {
+	if name := DisplayTagName(f.Tag); name != "" {
+		return t.Style(name)
+	}
+	return t.Style(l.TagName(f.Tag))
+}
+
+// displayTags holds the names of display tags.
+var displayTags = struct {
+	unlock chan int // used as mutex
+	names  map[int]string
+	tags   map[string]int
+	next   int // next tag to assign
+}{
+	unlock: make(chan int, 1),
+	names:  map[int]string{WrapTag: "wrap", FoldTag: "fold"},
+	tags:   map[string]int{"wrap": WrapTag, "fold": FoldTag},
+	next:   FoldTag - 1,
+}
+
+func init() {
+	displayTags.unlock <- 1
+}
+
+// DisplayTag returns the display tag with name, such as "selection" or
+// "diagnostic.error", for use by overlays and annotations. Display tags are
+// negative, so they are distinct from the tags applied by a Language's
+// rules, and a Theme styles them by name. The same name always returns the
+// same tag. WrapTag and FoldTag are the display tags named "wrap" and "fold".
+func DisplayTag(name string) int {
+	<-displayTags.unlock
+	tag, ok := displayTags.tags[name]
+	if !ok {
+		tag = displayTags.next
+		displayTags.next--
+		displayTags.names[tag] = name
+		displayTags.tags[name] = tag
+	}
+	displayTags.unlock <- 1
+	return tag
+}
+
+// DisplayTagName returns the name of tag, or the empty string if tag is not
+// a display tag.
+func DisplayTagName(tag int) string {
+	if tag > noneTag {
+		return ""
+	}
+	<-displayTags.unlock
+	name := displayTags.names[tag]
+	displayTags.unlock <- 1
+	return name
+}
@@ -0,0 +1,106 @@
+package edit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	c := RGB(0x12, 0x34, 0x56)
+	if r, g, b := c.RGB(); r != 0x12 || g != 0x34 || b != 0x56 {
+		t.Errorf("RGB returned %v, %v, %v; want 0x12, 0x34, 0x56", r, g, b)
+	}
+	if want, got := "#123456", c.String(); want != got {
+		t.Errorf("String returned %#v; want %#v", got, want)
+	}
+	if want, got := "#000000", RGB(0, 0, 0).String(); want != got {
+		t.Errorf("String returned %#v; want %#v", got, want)
+	}
+	if want, got := "default", DefaultColor.String(); want != got {
+		t.Errorf("String returned %#v; want %#v", got, want)
+	}
+}
+
+const testTheme = `{
+	"": {"fg": "#d0d0d0", "bg": "#202020"},
+	"comment": {"fg": "#808080", "italic": true},
+	"comment.doc": {"bold": true},
+	"comment.doc.tag": {"fg": "#f00", "italic": false}
+}`
+
+func TestTheme(t *testing.T) {
+	theme, err := ReadTheme(strings.NewReader(testTheme))
+	if err != nil {
+		t.Fatalf("ReadTheme returned error: %v", err)
+	}
+	fg, bg := RGB(0xd0, 0xd0, 0xd0), RGB(0x20, 0x20, 0x20)
+	gray, red := RGB(0x80, 0x80, 0x80), RGB(0xff, 0, 0)
+	for _, c := range []struct {
+		name string
+		want Style
+	}{
+		{"", Style{fg, bg, Off, Off, Off}},
+		{"keyword", Style{fg, bg, Off, Off, Off}},
+		{"comment", Style{gray, bg, Off, On, Off}},
+		{"comment.line", Style{gray, bg, Off, On, Off}},
+		{"comment.doc", Style{gray, bg, On, On, Off}},
+		{"comment.doc.tag", Style{red, bg, On, Off, Off}},
+		{"comment.doc.tag.name", Style{red, bg, On, Off, Off}},
+	} {
+		if got := theme.Style(c.name); c.want != got {
+			t.Errorf("Style(%#v) returned %v; want %v", c.name, got, c.want)
+		}
+	}
+
+	// NewTheme and FragmentStyle
+	theme = NewTheme(map[string]Style{"keyword": {Bold: On}})
+	l := &Language{Tags: []string{"keyword.control"}}
+	want := Style{DefaultColor, DefaultColor, On, Off, Off}
+	if got := theme.FragmentStyle(l, Fragment{"if", 0}); want != got {
+		t.Errorf("FragmentStyle returned %v; want %v", got, want)
+	}
+	want = Style{DefaultColor, DefaultColor, Off, Off, Off}
+	if got := theme.FragmentStyle(l, Fragment{" ", noneTag}); want != got {
+		t.Errorf("FragmentStyle returned %v; want %v", got, want)
+	}
+
+	// display tags are styled by name, apart from the language's tags
+	selection := DisplayTag("selection")
+	if selection >= FoldTag || DisplayTag("selection") != selection {
+		t.Errorf("DisplayTag returned %v, then %v", selection,
+			DisplayTag("selection"))
+	}
+	if want, got := "selection", DisplayTagName(selection); want != got {
+		t.Errorf("DisplayTagName returned %#v; want %#v", got, want)
+	}
+	if want, got := "", DisplayTagName(noneTag); want != got {
+		t.Errorf("DisplayTagName returned %#v; want %#v", got, want)
+	}
+	theme = NewTheme(map[string]Style{
+		"keyword":   {Bold: On},
+		"selection": {Bg: RGB(0, 0, 0xff)},
+		"fold":      {Italic: On},
+	})
+	for _, c := range []struct {
+		tag  int
+		want Style
+	}{
+		{selection, Style{DefaultColor, RGB(0, 0, 0xff), Off, Off, Off}},
+		{FoldTag, Style{DefaultColor, DefaultColor, Off, On, Off}},
+		{WrapTag, Style{DefaultColor, DefaultColor, Off, Off, Off}},
+		{0, Style{DefaultColor, DefaultColor, On, Off, Off}},
+	} {
+		if got := theme.FragmentStyle(l, Fragment{"x", c.tag}); c.want != got {
+			t.Errorf("FragmentStyle(%v) returned %v; want %v", c.tag, got,
+				c.want)
+		}
+	}
+
+	// errors
+	for _, s := range []string{`[]`, `{"a": {"fg": "red"}}`,
+		`{"a": {"bg": "#12345g"}}`} {
+		if _, err := ReadTheme(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadTheme(%#q) returned nil error", s)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package edit
+
+// tree is a sequence of values stored in a balanced binary tree (a treap).
+// Like a list.List it holds arbitrary values, but nodes are addressed by their
+// 1-based position in the sequence, and each node carries a weight so that
+// nodes can also be found by cumulative weight. All operations take O(log n)
+// time.
+type tree struct {
+	root *node
+	seed uint32 // state for priority generation
+}
+
+// node is an element of a tree.
+type node struct {
+	Value       interface{}
+	weight      int
+	priority    uint32
+	left, right *node
+	size        int // number of nodes in subtree
+	sum         int // total weight of subtree
+}
+
+func newTree() *tree {
+	return &tree{seed: 0x9e3779b9}
+}
+
+func size(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func sum(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.sum
+}
+
+// update recomputes the subtree totals of n from its children.
+func (n *node) update() {
+	n.size = 1 + size(n.left) + size(n.right)
+	n.sum = n.weight + sum(n.left) + sum(n.right)
+}
+
+// merge joins two trees, with all nodes of a preceding all nodes of b.
+func merge(a, b *node) *node {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
+
+// split divides a tree into its first k nodes and the remaining nodes.
+func split(n *node, k int) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	if size(n.left) >= k {
+		left, right := split(n.left, k)
+		n.left = right
+		n.update()
+		return left, n
+	}
+	left, right := split(n.right, k-size(n.left)-1)
+	n.right = left
+	n.update()
+	return n, right
+}
+
+// random returns a pseudo-random node priority.
+func (t *tree) random() uint32 {
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 17
+	t.seed ^= t.seed << 5
+	return t.seed
+}
+
+// Init clears the tree.
+func (t *tree) Init() {
+	t.root = nil
+}
+
+// Len returns the number of nodes in the tree.
+func (t *tree) Len() int {
+	return size(t.root)
+}
+
+// Weight returns the total weight of the nodes in the tree.
+func (t *tree) Weight() int {
+	return sum(t.root)
+}
+
+// Get returns the ith node in the tree, or nil if i is out of range.
+func (t *tree) Get(i int) *node {
+	n := t.root
+	for n != nil {
+		if l := size(n.left); i <= l {
+			n = n.left
+		} else if i == l+1 {
+			return n
+		} else {
+			i -= l + 1
+			n = n.right
+		}
+	}
+	return nil
+}
+
+// Set sets the value and weight of the ith node in the tree.
+func (t *tree) Set(i int, value interface{}, weight int) {
+	path := make([]*node, 0, 64)
+	n := t.root
+	for n != nil {
+		path = append(path, n)
+		if l := size(n.left); i <= l {
+			n = n.left
+		} else if i == l+1 {
+			n.Value, n.weight = value, weight
+			break
+		} else {
+			i -= l + 1
+			n = n.right
+		}
+	}
+	for j := len(path) - 1; j >= 0; j-- {
+		path[j].update()
+	}
+}
+
+// Insert inserts a node with the given value and weight into the tree so that
+// it becomes the ith node.
+func (t *tree) Insert(i int, value interface{}, weight int) {
+	n := &node{Value: value, weight: weight, priority: t.random()}
+	n.update()
+	left, right := split(t.root, i-1)
+	t.root = merge(merge(left, n), right)
+}
+
+// PushBack inserts a node with the given value and weight at the end of the
+// tree.
+func (t *tree) PushBack(value interface{}, weight int) {
+	t.Insert(t.Len()+1, value, weight)
+}
+
+// Remove removes the nodes from begin to end, inclusive.
+func (t *tree) Remove(begin, end int) {
+	left, rest := split(t.root, begin-1)
+	_, right := split(rest, end-begin+1)
+	t.root = merge(left, right)
+}
+
+// WeightBefore returns the total weight of the nodes preceding the ith node.
+func (t *tree) WeightBefore(i int) int {
+	w := 0
+	n := t.root
+	for n != nil {
+		if l := size(n.left); i <= l {
+			n = n.left
+		} else {
+			w += sum(n.left)
+			if i == l+1 {
+				break
+			}
+			w += n.weight
+			i -= l + 1
+			n = n.right
+		}
+	}
+	return w
+}
+
+// Find returns the position of the node spanning the 0-based cumulative
+// weight w, and the offset of w within the node's weight. If w is out of
+// range, the first or last node with nonzero weight is returned. If the tree
+// has no weight, the position returned is 0.
+func (t *tree) Find(w int) (i, offset int) {
+	if w < 0 {
+		w = 0
+	} else if w >= t.Weight() {
+		w = t.Weight() - 1
+	}
+	n := t.root
+	for n != nil {
+		if w < sum(n.left) {
+			n = n.left
+		} else if w -= sum(n.left); w < n.weight {
+			return i + size(n.left) + 1, w
+		} else {
+			w -= n.weight
+			i += size(n.left) + 1
+			n = n.right
+		}
+	}
+	return 0, 0
+}
+
+// Walk calls fn for each node in the tree in order, beginning with the ith
+// node, until fn returns false. The position of each node is passed to fn
+// along with the node. Values and weights may be changed using Set during the
+// walk, but nodes must not be inserted or removed.
+func (t *tree) Walk(i int, fn func(i int, n *node) bool) {
+	if i < 1 {
+		i = 1
+	}
+	stack := make([]*node, 0, 64)
+	pos := i
+	n := t.root
+	for n != nil {
+		if l := size(n.left); i <= l {
+			stack = append(stack, n)
+			n = n.left
+		} else if i == l+1 {
+			stack = append(stack, n)
+			break
+		} else {
+			i -= l + 1
+			n = n.right
+		}
+	}
+	for len(stack) > 0 {
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(pos, n) {
+			return
+		}
+		pos++
+		for n = n.right; n != nil; n = n.left {
+			stack = append(stack, n)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package edit
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkTree compares the contents of t to values and weights.
+func checkTree(t *testing.T, tr *tree, values, weights []int) {
+	if want, got := len(values), tr.Len(); want != got {
+		t.Fatalf("Len() == %v; want %v", got, want)
+	}
+	total := 0
+	for i, v := range values {
+		if want, got := total, tr.WeightBefore(i+1); want != got {
+			t.Errorf("WeightBefore(%v) == %v; want %v", i+1, got, want)
+		}
+		if want, got := v, tr.Get(i+1).Value.(int); want != got {
+			t.Errorf("Get(%v) == %v; want %v", i+1, got, want)
+		}
+		for j := 0; j < weights[i]; j++ {
+			if pos, offset := tr.Find(total + j); pos != i+1 || offset != j {
+				t.Errorf("Find(%v) == %v, %v; want %v, %v", total+j, pos,
+					offset, i+1, j)
+			}
+		}
+		total += weights[i]
+	}
+	if want, got := total, tr.Weight(); want != got {
+		t.Errorf("Weight() == %v; want %v", got, want)
+	}
+	i := 0
+	tr.Walk(1, func(pos int, n *node) bool {
+		if pos != i+1 || n.Value.(int) != values[i] {
+			t.Errorf("Walk() visited %v at %v; want %v at %v", n.Value, pos,
+				values[i], i+1)
+		}
+		i++
+		return true
+	})
+	if i != len(values) {
+		t.Errorf("Walk() visited %v nodes; want %v", i, len(values))
+	}
+}
+
+func TestTree(t *testing.T) {
+	tr := newTree()
+	if want, got := (*node)(nil), tr.Get(1); want != got {
+		t.Errorf("Get() == %v; want %v", got, want)
+	}
+	if pos, _ := tr.Find(0); pos != 0 {
+		t.Errorf("Find() == %v; want %v", pos, 0)
+	}
+
+	var values, weights []int
+	for i := 0; i < 500; i++ {
+		switch pos := 1 + rand.Intn(len(values)+1); rand.Intn(4) {
+		case 0, 1: // insert
+			w := rand.Intn(3)
+			tr.Insert(pos, i, w)
+			values = append(values[:pos-1],
+				append([]int{i}, values[pos-1:]...)...)
+			weights = append(weights[:pos-1],
+				append([]int{w}, weights[pos-1:]...)...)
+		case 2: // set
+			if pos <= len(values) {
+				w := rand.Intn(3)
+				tr.Set(pos, i, w)
+				values[pos-1], weights[pos-1] = i, w
+			}
+		case 3: // remove
+			if end := pos + rand.Intn(3); end <= len(values) {
+				tr.Remove(pos, end)
+				values = append(values[:pos-1], values[end:]...)
+				weights = append(weights[:pos-1], weights[end:]...)
+			}
+		}
+	}
+	checkTree(t, tr, values, weights)
+
+	// out-of-range Find
+	tr.Init()
+	tr.PushBack(1, 0)
+	tr.PushBack(2, 2)
+	tr.PushBack(3, 0)
+	if pos, offset := tr.Find(-1); pos != 2 || offset != 0 {
+		t.Errorf("Find(-1) == %v, %v; want %v, %v", pos, offset, 2, 0)
+	}
+	if pos, offset := tr.Find(5); pos != 2 || offset != 1 {
+		t.Errorf("Find(5) == %v, %v; want %v, %v", pos, offset, 2, 1)
+	}
+
+	// partial Walk
+	n := 0
+	tr.Walk(2, func(pos int, _ *node) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Walk() visited %v nodes; want %v", n, 1)
+	}
+}
@@ -0,0 +1,482 @@
+package edit
+
+import "container/list"
+
+// View is a display of a Buffer's contents. A View has its own display size,
+// scroll position, tab width, and wrapping, and shares the text, marks, undo
+// history, and syntax of its Buffer, so that one Buffer can be displayed in
+// several windows. A View is safe for concurrent use, and is updated as the
+// Buffer changes until it is closed.
+type View struct {
+	b          *Buffer
+	dLines     *tree // display lines; tree of lineDisplays, one per line
+	cols, rows int   // display size
+	tabWidth   int
+	wrap       WrapOptions
+	scroll     int
+	hscroll    int // columns scrolled horizontally, in no-wrap mode
+
+	highlighted int // number of leading lines with valid highlighting
+	laidOut     int // number of leading lines that are laid out
+}
+
+// NewView initializes and returns a new View of b, with the same default
+// settings as a new Buffer's display.
+func NewView(b *Buffer) *View {
+	<-b.unlock
+	v := b.newView()
+	b.unlock <- 1
+	return v
+}
+
+func (b *Buffer) newView() *View {
+	v := &View{
+		b:        b,
+		dLines:   newTree(),
+		cols:     80,
+		rows:     25,
+		tabWidth: 8,
+	}
+	b.views = append(b.views, v)
+	v.reset()
+	return v
+}
+
+// Buffer returns the Buffer that v displays.
+func (v *View) Buffer() *Buffer {
+	return v.b
+}
+
+// Close detaches v from its Buffer, so that it is no longer updated. A
+// Buffer's own display cannot be closed. A closed View must not be used.
+func (v *View) Close() {
+	<-v.b.unlock
+	if v != v.b.view {
+		for i, view := range v.b.views {
+			if view == v {
+				v.b.views = append(v.b.views[:i], v.b.views[i+1:]...)
+				break
+			}
+		}
+	}
+	v.b.unlock <- 1
+}
+
+// redisplay rewraps the lines from begin to end without highlighting them.
+// They are highlighted when they are displayed; see highlight.
+func (v *View) redisplay(begin, end int) {
+	v.b.lines.Walk(begin, func(i int, text []rune) bool {
+		l := v.layout(i, text)
+		v.set(i, lineDisplay{rows: l.rows(l.plain())})
+		return i < end
+	})
+	v.invalidate(begin)
+}
+
+// unlaid is the display of a line that hasn't been laid out, shared by all
+// such lines.
+var unlaid interface{} = lineDisplay{}
+
+// reset discards the display of every line, so that lines are laid out and
+// highlighted again when they are displayed. Until then, each line that isn't
+// hidden takes up a single row.
+func (v *View) reset() {
+	v.dLines.Init()
+	for i := 1; i <= v.b.lines.Len(); i++ {
+		weight := 1
+		if len(v.b.folds) > 0 && v.b.hidden(i) {
+			weight = 0
+		}
+		v.dLines.PushBack(unlaid, weight)
+	}
+	v.laidOut = 0
+	v.invalidate(1)
+}
+
+// resize is like redisplay, except it doesn't re-highlight the text. Lines
+// that haven't been laid out are left for layOut.
+func (v *View) resize() {
+	v.dLines.Walk(1, func(i int, n *node) bool {
+		if display := n.Value.(lineDisplay); display.rows != nil {
+			v.set(i, v.relayout(i, display))
+		}
+		return true
+	})
+}
+
+// layOutTo lays out the lines up to line that haven't been laid out, so that
+// the rows of the lines up to it are exact.
+func (v *View) layOutTo(line int) {
+	if line > v.b.lines.Len() {
+		line = v.b.lines.Len()
+	}
+	if v.laidOut >= line {
+		return
+	}
+	v.dLines.Walk(v.laidOut+1, func(i int, n *node) bool {
+		if display := n.Value.(lineDisplay); display.rows == nil {
+			v.set(i, v.relayout(i, display))
+		}
+		return i < line
+	})
+	v.laidOut = line
+}
+
+// layOutRow lays out the lines up to the one displayed at row. Laying out
+// lines can give them more rows, so the line at row is found again until it
+// is laid out.
+func (v *View) layOutRow(row int) {
+	for {
+		line, _ := v.dLines.Find(row)
+		if line <= v.laidOut {
+			return
+		}
+		v.layOutTo(line)
+	}
+}
+
+// layOut lays out the lines up to the last one on the view's display.
+func (v *View) layOut() {
+	v.layOutRow(v.scroll + v.rows - 1)
+}
+
+// moveLayout updates the number of leading lines that are laid out after n
+// lines are inserted after line, or -n lines are deleted after line if n is
+// negative. Edited lines are laid out again by redisplay.
+func (v *View) moveLayout(line, n int) {
+	switch {
+	case v.laidOut < line:
+	case n >= 0 || v.laidOut >= line-n:
+		v.laidOut += n
+	default:
+		v.laidOut = line
+	}
+}
+
+// CoordsFromIndex returns the display coordinates of index. Coordinates may be
+// out of bounds of the view's current display.
+func (v *View) CoordsFromIndex(index Index) (col, row int) {
+	<-v.b.unlock
+	index = v.b.visible(v.b.clip(index))
+	v.layOutTo(index.Line)
+	text := v.b.lines.Line(index.Line)
+	col, row = v.layout(index.Line, text).coords(index.Char)
+	col -= v.hscroll
+	row += v.dLines.WeightBefore(index.Line) - v.scroll
+	v.b.unlock <- 1
+	return
+}
+
+// DisplayLines returns a slice of Lists of Fragments, one list for each line
+// on the view's current display.
+func (v *View) DisplayLines() []*list.List {
+	<-v.b.unlock
+	lines := make([]*list.List, v.rows)
+	for i := range lines {
+		lines[i] = list.New()
+	}
+	last, _ := v.dLines.Find(v.scroll + v.rows - 1)
+	v.highlight(last + highlightMargin)
+	v.layOut()
+	i, offset := v.dLines.Find(v.scroll)
+	row := 0
+	v.dLines.Walk(i, func(i int, n *node) bool {
+		if n.weight == 0 {
+			return true // hidden by a fold
+		}
+		rows := v.withPlaceholder(i, v.overlay(i, n.Value.(lineDisplay)))
+		for _, dLine := range rows[offset:] {
+			if row >= len(lines) {
+				return false
+			}
+			if v.wrap.Mode == NoWrap {
+				dLine = clipRow(dLine, v.hscroll, v.hscroll+v.cols)
+			}
+			for _, frag := range dLine {
+				lines[row].PushBack(frag)
+			}
+			row++
+		}
+		offset = 0
+		return row < len(lines)
+	})
+	v.b.unlock <- 1
+	return lines
+}
+
+// DisplayRow is a row of a display, with information about the line it
+// displays.
+type DisplayRow struct {
+	Fragments []Fragment
+
+	// Line is the number of the line displayed on the row, or 0 if the row
+	// is past the end of the buffer.
+	Line int
+
+	// Continuation is true if the row continues a wrapped line.
+	Continuation bool
+
+	// Start is the index of the first character on the row.
+	Start Index
+
+	// Signs holds the signs in the gutter beside the line, in order of
+	// decreasing priority. Continuation rows have no signs.
+	Signs []Sign
+}
+
+// DisplayRows is like DisplayLines, but returns each row of the view's
+// current display with information about the line it displays.
+func (v *View) DisplayRows() []DisplayRow {
+	<-v.b.unlock
+	rows := make([]DisplayRow, 0, v.rows)
+	last, _ := v.dLines.Find(v.scroll + v.rows - 1)
+	v.highlight(last + highlightMargin)
+	v.layOut()
+	last, _ = v.dLines.Find(v.scroll + v.rows - 1)
+	i, offset := v.dLines.Find(v.scroll)
+	signs := v.b.signsBetween(i, last)
+	v.dLines.Walk(i, func(line int, n *node) bool {
+		if n.weight == 0 {
+			return true // hidden by a fold
+		}
+		l := v.layout(line, v.b.lines.Line(line))
+		dLines := v.withPlaceholder(line, v.overlay(line, n.Value.(lineDisplay)))
+		for k, dLine := range dLines {
+			if k < offset {
+				continue
+			} else if len(rows) == v.rows {
+				return false
+			}
+			if v.wrap.Mode == NoWrap {
+				dLine = clipRow(dLine, v.hscroll, v.hscroll+v.cols)
+			}
+			row := DisplayRow{
+				Fragments:    append([]Fragment(nil), dLine...),
+				Line:         line,
+				Continuation: k > 0,
+				Start:        Index{line, l.charAt(0, k)},
+			}
+			if k == 0 {
+				row.Signs = signs[line]
+			}
+			rows = append(rows, row)
+		}
+		offset = 0
+		return len(rows) < v.rows
+	})
+	for len(rows) < v.rows {
+		rows = append(rows, DisplayRow{})
+	}
+	v.b.unlock <- 1
+	return rows
+}
+
+// IndexFromCoords returns the closest index to the given display coordinates.
+func (v *View) IndexFromCoords(col, row int) Index {
+	<-v.b.unlock
+
+	// clip values
+	col += v.hscroll
+	if col < 0 {
+		col = 0
+	}
+	row += v.scroll
+	v.layOutRow(row)
+
+	// get line
+	line, offset := v.dLines.Find(row)
+	index := Index{line, v.layout(line, v.b.lines.Line(line)).charAt(col, offset)}
+
+	v.b.unlock <- 1
+	return index
+}
+
+func (v *View) scrollWithoutLock(delta int) {
+	v.scroll += delta
+	if v.scroll+v.rows > v.dLines.Weight() {
+		v.layOutTo(v.b.lines.Len()) // the end of the buffer may be displayed
+	}
+	if v.scroll < 0 || v.dLines.Weight() < v.rows {
+		v.scroll = 0
+	} else if v.scroll+v.rows > v.dLines.Weight() {
+		v.scroll = v.dLines.Weight() - v.rows
+	}
+	v.layOut()
+}
+
+// Scroll scrolls the view's display down by delta lines.
+func (v *View) Scroll(delta int) {
+	<-v.b.unlock
+	v.scrollWithoutLock(delta)
+	v.b.unlock <- 1
+}
+
+// ScrollColumns scrolls the view's display right by delta columns, if lines
+// are not wrapped. The display cannot be scrolled left of the first column.
+func (v *View) ScrollColumns(delta int) {
+	<-v.b.unlock
+	if v.wrap.Mode == NoWrap {
+		v.hscroll += delta
+		if v.hscroll < 0 {
+			v.hscroll = 0
+		}
+	}
+	v.b.unlock <- 1
+}
+
+// HorizontalScroll returns the number of columns the view's display is
+// scrolled right.
+func (v *View) HorizontalScroll() int {
+	<-v.b.unlock
+	hscroll := v.hscroll
+	v.b.unlock <- 1
+	return hscroll
+}
+
+// ScrollFraction returns a number in the range [0, 1] describing the vertical
+// scroll fraction of the view's display. If the entire content is visible, -1
+// is returned instead. The whole buffer must be laid out to find its number of
+// rows, so the first call after the buffer is loaded can be slow.
+func (v *View) ScrollFraction() float64 {
+	<-v.b.unlock
+	v.layOutTo(v.b.lines.Len())
+	f := -1.0
+	if v.rows < v.dLines.Weight() {
+		f = float64(v.scroll) / float64(v.dLines.Weight()-v.rows)
+	}
+	v.b.unlock <- 1
+	return f
+}
+
+// SeeMode determines where See places an index on the display.
+type SeeMode int
+
+// See modes.
+const (
+	// SeeMinimal scrolls as little as possible to keep the index Margin
+	// rows from the top and bottom of the display.
+	SeeMinimal SeeMode = iota
+
+	// SeeCenter scrolls so that the index is on the middle row.
+	SeeCenter
+
+	// SeeTop scrolls so that the index is Margin rows below the top row.
+	SeeTop
+
+	// SeeBottom scrolls so that the index is Margin rows above the bottom
+	// row.
+	SeeBottom
+)
+
+// SeePolicy determines how See scrolls to an index.
+type SeePolicy struct {
+	Mode SeeMode
+
+	// Margin is the number of rows to keep between the index and the top
+	// or bottom of the display, if possible. It is limited to half of the
+	// display's height.
+	Margin int
+}
+
+// See scrolls the view's display so that index is visible, following policy.
+// If lines are not wrapped, the display is also scrolled horizontally as
+// little as possible.
+func (v *View) See(index Index, policy SeePolicy) {
+	<-v.b.unlock
+	index = v.b.visible(v.b.clip(index))
+	v.layOutTo(index.Line)
+	col, row := v.layout(index.Line, v.b.lines.Line(index.Line)).coords(index.Char)
+	row += v.dLines.WeightBefore(index.Line)
+	margin := policy.Margin
+	if max := (v.rows - 1) / 2; margin > max {
+		margin = max
+	}
+	if margin < 0 {
+		margin = 0
+	}
+	switch policy.Mode {
+	case SeeMinimal:
+		if row-margin < v.scroll {
+			v.scroll = row - margin
+		} else if row+margin >= v.scroll+v.rows {
+			v.scroll = row + margin - v.rows + 1
+		}
+	case SeeCenter:
+		v.scroll = row - (v.rows-1)/2
+	case SeeTop:
+		v.scroll = row - margin
+	case SeeBottom:
+		v.scroll = row + margin - v.rows + 1
+	}
+	v.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	if v.wrap.Mode == NoWrap {
+		if col < v.hscroll {
+			v.hscroll = col
+		} else if col >= v.hscroll+v.cols {
+			v.hscroll = col - v.cols + 1
+		}
+	}
+	v.b.unlock <- 1
+}
+
+// VisibleRange returns the indexes of the beginning of the first row and the
+// end of the last row on the view's display. Rows are considered whole even
+// if the display is scrolled horizontally.
+func (v *View) VisibleRange() (begin, end Index) {
+	<-v.b.unlock
+	v.layOut()
+	line, offset := v.dLines.Find(v.scroll)
+	l := v.layout(line, v.b.lines.Line(line))
+	begin = Index{line, l.charAt(0, offset)}
+	last := v.scroll + v.rows - 1
+	if last < v.scroll {
+		last = v.scroll
+	}
+	line, offset = v.dLines.Find(last)
+	l = v.layout(line, v.b.lines.Line(line))
+	end = Index{line, l.charAt(0, offset+1)}
+	if offset+1 >= len(l.starts) {
+		end.Char = l.length
+	}
+	v.b.unlock <- 1
+	return begin, end
+}
+
+// SetSize sets the display size of the view.
+func (v *View) SetSize(cols, rows int) {
+	<-v.b.unlock
+	v.cols, v.rows = cols, rows
+	if v.cols < 1 {
+		v.cols = 1
+	}
+	if v.rows < 0 {
+		v.rows = 0
+	}
+	v.resize()
+	v.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	v.b.unlock <- 1
+}
+
+// SetWrap sets how lines wider than the display are wrapped.
+func (v *View) SetWrap(opts WrapOptions) {
+	<-v.b.unlock
+	v.wrap = opts
+	if opts.Mode != NoWrap {
+		v.hscroll = 0
+	}
+	v.resize()
+	v.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	v.b.unlock <- 1
+}
+
+// SetTabWidth sets the tab width of the view to cols.
+func (v *View) SetTabWidth(cols int) {
+	<-v.b.unlock
+	prevWidth := v.tabWidth
+	v.tabWidth = cols
+	if prevWidth != cols {
+		v.reset()
+		v.scrollWithoutLock(0) // make sure scroll isn't out of bounds
+	}
+	v.b.unlock <- 1
+}
@@ -0,0 +1,209 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(10, 2)
+	v := NewView(b)
+	if v.Buffer() != b {
+		t.Errorf("Buffer() == %p; want %p", v.Buffer(), b)
+	}
+	v.SetSize(4, 3)
+	b.Insert(b.End(), "hello\nworld\n!")
+
+	want := [][]Fragment{{{"hello", noneTag}}, {{"world", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("Buffer.DisplayLines() == %v; want %v", got, want)
+	}
+	want = [][]Fragment{{{"hell", noneTag}}, {{"o", noneTag}},
+		{{"worl", noneTag}}}
+	if got := displayFragments(v); !reflect.DeepEqual(want, got) {
+		t.Errorf("View.DisplayLines() == %v; want %v", got, want)
+	}
+
+	// scroll positions are independent
+	v.Scroll(2)
+	want = [][]Fragment{{{"worl", noneTag}}, {{"d", noneTag}},
+		{{"!", noneTag}}}
+	if got := displayFragments(v); !reflect.DeepEqual(want, got) {
+		t.Errorf("View.DisplayLines() == %v; want %v", got, want)
+	}
+	if col, row := v.CoordsFromIndex(Index{2, 5}); col != 1 || row != 1 {
+		t.Errorf("View.CoordsFromIndex() == %v, %v; want 1, 1", col, row)
+	}
+	if want, got := (Index{2, 5}), v.IndexFromCoords(1, 1); want != got {
+		t.Errorf("View.IndexFromCoords() == %v; want %v", got, want)
+	}
+	if col, row := b.CoordsFromIndex(Index{2, 5}); col != 5 || row != 1 {
+		t.Errorf("Buffer.CoordsFromIndex() == %v, %v; want 5, 1", col, row)
+	}
+
+	// edits and syntax are shared
+	rule, _ := NewRule(`o`, 1)
+	b.SetSyntax([]Rule{rule})
+	b.Delete(Index{1, 0}, Index{2, 0})
+	v.Scroll(-2)
+	want = [][]Fragment{{{"w", noneTag}, {"o", 1}, {"rl", noneTag}},
+		{{"d", noneTag}}, {{"!", noneTag}}}
+	if got := displayFragments(v); !reflect.DeepEqual(want, got) {
+		t.Errorf("View.DisplayLines() == %v; want %v", got, want)
+	}
+	b.ReadFrom(strings.NewReader("a\tb"))
+	v.SetTabWidth(2)
+	want = [][]Fragment{{{"a b", noneTag}}, nil, nil}
+	if got := displayFragments(v); !reflect.DeepEqual(want, got) {
+		t.Errorf("View.DisplayLines() == %v; want %v", got, want)
+	}
+	want = [][]Fragment{{{"a       b", noneTag}}, nil}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("Buffer.DisplayLines() == %v; want %v", got, want)
+	}
+
+	// closed views are not updated
+	v.Close()
+	if n := len(b.views); n != 1 {
+		t.Errorf("Buffer has %d views after Close(); want 1", n)
+	}
+	b.view.Close()
+	if n := len(b.views); n != 1 {
+		t.Errorf("Buffer has %d views after closing its own view; want 1", n)
+	}
+}
+
+func TestViewSee(t *testing.T) {
+	b := NewBuffer()
+	v := NewView(b)
+	v.SetSize(4, 4)
+	b.Insert(b.End(), strings.Repeat("abcdef\n", 9)+"x")
+
+	for _, c := range []struct {
+		index  Index
+		policy SeePolicy
+		scroll int
+	}{
+		{Index{1, 0}, SeePolicy{}, 0},
+		{Index{2, 5}, SeePolicy{}, 0},
+		{Index{3, 0}, SeePolicy{}, 1}, // minimal, across wrapped rows
+		{Index{3, 0}, SeePolicy{Margin: 1}, 2},
+		{Index{2, 0}, SeePolicy{Margin: 1}, 1},
+		{Index{5, 4}, SeePolicy{Mode: SeeCenter}, 8},
+		{Index{5, 0}, SeePolicy{Mode: SeeTop}, 8},
+		{Index{5, 0}, SeePolicy{Mode: SeeTop, Margin: 5}, 7},
+		{Index{5, 0}, SeePolicy{Mode: SeeBottom}, 5},
+		{Index{1, 0}, SeePolicy{Mode: SeeBottom}, 0}, // clipped
+		{Index{10, 1}, SeePolicy{Mode: SeeTop}, 15},  // clipped
+	} {
+		v.See(c.index, c.policy)
+		if _, row := v.CoordsFromIndex(Index{1, 0}); -row != c.scroll {
+			t.Errorf("See(%v, %+v) scrolled to %v; want %v", c.index,
+				c.policy, -row, c.scroll)
+		}
+	}
+
+	begin, end := v.VisibleRange()
+	if want := (Index{8, 4}); want != begin {
+		t.Errorf("VisibleRange() begin == %v; want %v", begin, want)
+	}
+	if want := (Index{10, 1}); want != end {
+		t.Errorf("VisibleRange() end == %v; want %v", end, want)
+	}
+	v.Scroll(-3)
+	if begin, end = v.VisibleRange(); begin != (Index{7, 0}) ||
+		end != (Index{8, 6}) {
+		t.Errorf("VisibleRange() == %v, %v; want {7 0}, {8 6}", begin, end)
+	}
+
+	// horizontal scrolling
+	v.SetWrap(WrapOptions{Mode: NoWrap})
+	v.See(Index{1, 6}, SeePolicy{})
+	if want, got := 3, v.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+	v.See(Index{1, 1}, SeePolicy{})
+	if want, got := 1, v.HorizontalScroll(); want != got {
+		t.Errorf("HorizontalScroll() == %v; want %v", got, want)
+	}
+}
+
+func TestViewLazyLayout(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(4, 2)
+	b.ReadFrom(strings.NewReader("abcdefgh\nij\nklmnop\nqrstuvwx"))
+
+	// lines past the display take up a row each until they are laid out
+	if want, got := 5, b.view.dLines.Weight(); want != got {
+		t.Errorf("display weight == %v; want %v", got, want)
+	}
+	want := [][]Fragment{{{"abcd", noneTag}}, {{"efgh", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// coordinates are exact, whether the lines have been displayed or not
+	for _, c := range []struct {
+		index    Index
+		col, row int
+	}{
+		{Index{4, 1}, 1, 5},
+		{Index{3, 0}, 0, 3},
+		{Index{2, 1}, 1, 2},
+	} {
+		if col, row := b.CoordsFromIndex(c.index); col != c.col || row != c.row {
+			t.Errorf("CoordsFromIndex(%v) == %v, %v; want %v, %v",
+				c.index, col, row, c.col, c.row)
+		}
+		if index := b.IndexFromCoords(c.col, c.row); index != c.index {
+			t.Errorf("IndexFromCoords(%v, %v) == %v; want %v",
+				c.col, c.row, index, c.index)
+		}
+	}
+
+	// coordinates don't change when lines are displayed
+	b.ReadFrom(strings.NewReader("aaaaaaaaaaaa\nb\nc"))
+	b.SetSize(5, 1)
+	col, row := b.CoordsFromIndex(Index{2, 0})
+	b.Scroll(4)
+	b.DisplayLines()
+	b.Scroll(-4)
+	if col2, row2 := b.CoordsFromIndex(Index{2, 0}); col2 != col ||
+		row2 != row || row != 3 {
+		t.Errorf("CoordsFromIndex() == %v, %v, then %v, %v; want 0, 3",
+			col, row, col2, row2)
+	}
+
+	// edits keep track of the lines that are laid out
+	b.ReadFrom(strings.NewReader("abcdefgh\nij\nklmnop\nqrstuvwx"))
+	b.Insert(Index{1, 8}, "\n\n")
+	b.Delete(Index{2, 0}, Index{3, 0})
+	if col, row := b.CoordsFromIndex(Index{5, 1}); col != 1 || row != 6 {
+		t.Errorf("CoordsFromIndex() == %v, %v; want 1, 6", col, row)
+	}
+}
+
+func TestViewSeeLoaded(t *testing.T) {
+	b := NewBuffer()
+	b.SetSize(5, 3)
+	b.ReadFrom(strings.NewReader(strings.Repeat("abcdefghijk\n", 9) + "zzz"))
+
+	b.See(Index{10, 0}, SeePolicy{})
+	want := [][]Fragment{{{"fghij", noneTag}}, {{"k", noneTag}},
+		{{"zzz", noneTag}}}
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+
+	// scrolling stops at the real end of the buffer
+	b.ReadFrom(strings.NewReader(strings.Repeat("abcdefghijk\n", 9) + "zzz"))
+	b.Scroll(100)
+	if got := displayFragments(b); !reflect.DeepEqual(want, got) {
+		t.Errorf("DisplayLines() == %v; want %v", got, want)
+	}
+	if want, got := 1.0, b.ScrollFraction(); want != got {
+		t.Errorf("ScrollFraction() == %v; want %v", got, want)
+	}
+}